@@ -0,0 +1,268 @@
+/*
+  Source Configuration Service
+  © 2022 Southwinds Tech Ltd - www.southwinds.io
+  Licensed under the Apache License, Version 2.0 at http://www.apache.org/licenses/LICENSE-2.0
+  Contributors to this project, hereby assign copyright in this code to the project,
+  to be licensed under the same terms as the rest of the code.
+*/
+
+package src
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// DesiredItem the desired state of a configuration item
+type DesiredItem struct {
+	// Key the unique key of the item, wildcards are not allowed
+	Key string
+	// Type the item type used to validate the item value
+	Type string
+	// Value the item value, it must not be a pointer
+	Value Valid
+	// Tags the tags the item must have, keyed by tag name; use an empty value for tags without a value
+	Tags map[string]string
+	// Links the keys of the items this item must be linked to
+	Links []string
+}
+
+// DesiredState the desired state of a set of configuration items
+type DesiredState struct {
+	Items []DesiredItem
+}
+
+// ApplyOptions the options used to converge the source server to a desired state
+type ApplyOptions struct {
+	// DryRun computes and reports the operations without applying them
+	DryRun bool
+	// Prune deletes the items of the types in the desired state that are not in the desired state
+	Prune bool
+}
+
+// Operation an operation required to converge the source server to a desired state
+type Operation struct {
+	// Action one of save, delete, tag, untag, link or unlink
+	Action string
+	// Key the key of the item the operation applies to
+	Key string
+	// Target the tag name for tag operations or the item key linked to for link operations
+	Target string
+}
+
+func (o Operation) String() string {
+	if len(o.Target) > 0 {
+		return fmt.Sprintf("%s %s -> %s", o.Action, o.Key, o.Target)
+	}
+	return fmt.Sprintf("%s %s", o.Action, o.Key)
+}
+
+// ApplyReport the operations applied, or planned if in dry-run mode
+type ApplyReport struct {
+	DryRun     bool
+	Operations []Operation
+}
+
+// Apply computes the minimal set of operations required to converge the source server to the desired state
+// and applies them in order: saves, tags, links, and if pruning, deletes
+// in dry-run mode the operations are only reported
+// if an operation fails, the report contains the operations applied before the failure
+func (c *Client) Apply(desired DesiredState, opts ApplyOptions) (ApplyReport, error) {
+	report := ApplyReport{DryRun: opts.DryRun}
+	plan, err := c.plan(desired, opts)
+	if err != nil {
+		return report, err
+	}
+	if opts.DryRun {
+		report.Operations = plan
+		return report, nil
+	}
+	items := make(map[string]DesiredItem, len(desired.Items))
+	for _, item := range desired.Items {
+		items[item.Key] = item
+	}
+	for _, op := range plan {
+		switch op.Action {
+		case "save":
+			err = c.Save(op.Key, items[op.Key].Type, items[op.Key].Value)
+		case "tag":
+			err = c.Tag(op.Key, op.Target, items[op.Key].Tags[op.Target])
+		case "untag":
+			err = c.Untag(op.Key, op.Target)
+		case "link":
+			err = c.Link(op.Key, op.Target)
+		case "unlink":
+			err = c.Unlink(op.Key, op.Target)
+		case "delete":
+			err = c.Delete(op.Key)
+		}
+		if err != nil {
+			return report, fmt.Errorf("cannot apply '%s': %s", op, err)
+		}
+		report.Operations = append(report.Operations, op)
+	}
+	return report, nil
+}
+
+// SetTags converges the tags of the item identified by key to exactly the desired tags, e.g. to relabel it
+// declaratively; the tags missing or with another value are tagged and the tags not desired are untagged
+// returns the operations applied, which on failure are those applied before it
+func (c *Client) SetTags(itemKey string, desired []T) ([]Operation, error) {
+	desiredTags := make(map[string]string, len(desired))
+	for _, tag := range desired {
+		if len(tag.Name) == 0 {
+			return nil, fmt.Errorf("a tag name is required")
+		}
+		if value, exists := desiredTags[tag.Name]; exists && value != tag.Value {
+			return nil, fmt.Errorf("tag '%s' is desired with more than one value", tag.Name)
+		}
+		desiredTags[tag.Name] = tag.Value
+	}
+	current, err := c.GetTags(itemKey)
+	if err != nil {
+		return nil, err
+	}
+	var applied []Operation
+	for _, op := range diffTags(DesiredItem{Key: itemKey, Tags: desiredTags}, current) {
+		if op.Action == "tag" {
+			err = c.Tag(itemKey, op.Target, desiredTags[op.Target])
+		} else {
+			err = c.Untag(itemKey, op.Target)
+		}
+		if err != nil {
+			return applied, fmt.Errorf("cannot apply '%s': %s", op, err)
+		}
+		applied = append(applied, op)
+	}
+	return applied, nil
+}
+
+// plan diffs the desired state against the current state of the source server
+func (c *Client) plan(desired DesiredState, opts ApplyOptions) ([]Operation, error) {
+	var saves, tags, links, deletes []Operation
+	// the current items of the managed types keyed by item key
+	current := map[string]I{}
+	loadedTypes := map[string]bool{}
+	desiredKeys := map[string]bool{}
+	for _, item := range desired.Items {
+		if len(item.Key) == 0 || strings.Contains(item.Key, "?") {
+			return nil, fmt.Errorf("invalid key '%s': desired items require a key without wildcards", item.Key)
+		}
+		if desiredKeys[item.Key] {
+			return nil, fmt.Errorf("item '%s' is defined more than once in the desired state", item.Key)
+		}
+		desiredKeys[item.Key] = true
+		if loadedTypes[item.Type] {
+			continue
+		}
+		items, err := c.LoadItemsByTypeRaw(item.Type)
+		if err != nil {
+			return nil, err
+		}
+		for _, i := range items {
+			current[i.Key] = i
+		}
+		loadedTypes[item.Type] = true
+	}
+	for _, item := range desired.Items {
+		existing, exists := current[item.Key]
+		changed, err := c.valueChanged(existing, exists, item)
+		if err != nil {
+			return nil, err
+		}
+		if changed {
+			saves = append(saves, Operation{Action: "save", Key: item.Key})
+		}
+		var currentTags []T
+		var children IL
+		if exists {
+			if currentTags, err = c.GetTags(item.Key); err != nil {
+				return nil, err
+			}
+			if children, err = c.LoadChildrenRaw(item.Key); err != nil {
+				return nil, err
+			}
+		}
+		tags = append(tags, diffTags(item, currentTags)...)
+		links = append(links, diffLinks(item, children)...)
+	}
+	if opts.Prune {
+		for _, i := range current {
+			if !desiredKeys[i.Key] {
+				deletes = append(deletes, Operation{Action: "delete", Key: i.Key})
+			}
+		}
+		sort.Slice(deletes, func(i, j int) bool { return deletes[i].Key < deletes[j].Key })
+	}
+	return append(append(append(saves, tags...), links...), deletes...), nil
+}
+
+// valueChanged true if the desired value or type differs from the one stored
+func (c *Client) valueChanged(existing I, exists bool, item DesiredItem) (bool, error) {
+	if !exists || existing.Type != item.Type {
+		return true, nil
+	}
+	desiredBytes, err := c.opts.Codec.Marshal(item.Value)
+	if err != nil {
+		return false, err
+	}
+	var desiredValue, currentValue any
+	if err = defaultCodec.Unmarshal(desiredBytes, &desiredValue); err != nil {
+		return false, err
+	}
+	if err = defaultCodec.Unmarshal(existing.Value, &currentValue); err != nil {
+		return true, nil
+	}
+	return !reflect.DeepEqual(desiredValue, currentValue), nil
+}
+
+func diffTags(item DesiredItem, current []T) []Operation {
+	var ops []Operation
+	currentTags := make(map[string]string, len(current))
+	for _, tag := range current {
+		currentTags[tag.Name] = tag.Value
+	}
+	for _, name := range sortedKeys(item.Tags) {
+		if value, ok := currentTags[name]; !ok || value != item.Tags[name] {
+			ops = append(ops, Operation{Action: "tag", Key: item.Key, Target: name})
+		}
+	}
+	for _, tag := range current {
+		if _, ok := item.Tags[tag.Name]; !ok {
+			ops = append(ops, Operation{Action: "untag", Key: item.Key, Target: tag.Name})
+		}
+	}
+	return ops
+}
+
+func diffLinks(item DesiredItem, children IL) []Operation {
+	var ops []Operation
+	currentLinks := make(map[string]bool, len(children))
+	for _, child := range children {
+		currentLinks[child.Key] = true
+	}
+	desiredLinks := make(map[string]bool, len(item.Links))
+	for _, to := range item.Links {
+		desiredLinks[to] = true
+		if !currentLinks[to] {
+			ops = append(ops, Operation{Action: "link", Key: item.Key, Target: to})
+		}
+	}
+	for _, child := range children {
+		if !desiredLinks[child.Key] {
+			ops = append(ops, Operation{Action: "unlink", Key: item.Key, Target: child.Key})
+		}
+	}
+	return ops
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,226 @@
+/*
+  Source Configuration Service
+  © 2022 Southwinds Tech Ltd - www.southwinds.io
+  Licensed under the Apache License, Version 2.0 at http://www.apache.org/licenses/LICENSE-2.0
+  Contributors to this project, hereby assign copyright in this code to the project,
+  to be licensed under the same terms as the rest of the code.
+*/
+
+package src
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+// tarTypeRecord the PAX record carrying the type of an item entry
+const tarTypeRecord = "SOURCE.type"
+
+// ExportOptions the options used to export the store as a tar archive
+type ExportOptions struct {
+	// Types the item types exported, all the types if empty
+	Types []string
+	// SkipTags does not export the tags of the items
+	SkipTags bool
+	// SkipLinks does not export the links between the items
+	SkipLinks bool
+}
+
+// ExportTar writes the store to w as a tar archive, streaming the items a page at a time, with the entries:
+//   - types/<type>.json: the type information including its schema and prototype
+//   - items/<key>: the item value, with the item type in the SOURCE.type PAX record
+//   - tags/<key>.json: the tags of the item, if it has any
+//   - links.json: the links between the items
+//
+// e.g. to analyse the configuration offline using standard tools; restore it using ImportTar
+func (c *Client) ExportTar(w io.Writer, opts ExportOptions) error {
+	tw := tar.NewWriter(w)
+	types, err := c.ListTypes()
+	if err != nil {
+		return err
+	}
+	exported := map[string]bool{}
+	for _, t := range opts.Types {
+		exported[t] = true
+	}
+	now := c.opts.Clock.Now()
+	for _, t := range types {
+		if len(exported) > 0 && !exported[t.Key] {
+			continue
+		}
+		if err = writeTarJSON(tw, path.Join("types", t.Key+".json"), t, now); err != nil {
+			return err
+		}
+	}
+	for _, t := range types {
+		if len(exported) > 0 && !exported[t.Key] {
+			continue
+		}
+		if err = c.exportItems(tw, t.Key, opts); err != nil {
+			return err
+		}
+	}
+	if !opts.SkipLinks {
+		links, linksErr := c.ListLinks()
+		if linksErr != nil {
+			return linksErr
+		}
+		if err = writeTarJSON(tw, "links.json", links, now); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// exportItems writes the items of the type and their tags a page at a time
+func (c *Client) exportItems(tw *tar.Writer, itemType string, opts ExportOptions) error {
+	for offset := 0; ; offset += PageSize {
+		page, err := c.LoadItemsByTypePage(itemType, offset, PageSize)
+		if err != nil {
+			return err
+		}
+		keys := make([]string, len(page))
+		for i, item := range page {
+			keys[i] = item.Key
+			header := &tar.Header{
+				Name:       path.Join("items", item.Key),
+				Mode:       0644,
+				Size:       int64(len(item.Value)),
+				ModTime:    item.Updated,
+				Format:     tar.FormatPAX,
+				PAXRecords: map[string]string{tarTypeRecord: item.Type},
+			}
+			if err = tw.WriteHeader(header); err != nil {
+				return err
+			}
+			if _, err = tw.Write(item.Value); err != nil {
+				return err
+			}
+		}
+		if !opts.SkipTags && len(keys) > 0 {
+			tags, tagsErr := c.GetTagsBatch(keys)
+			if tagsErr != nil {
+				return tagsErr
+			}
+			for _, item := range page {
+				if len(tags[item.Key]) == 0 {
+					continue
+				}
+				if err = writeTarJSON(tw, path.Join("tags", item.Key+".json"), tags[item.Key], item.Updated); err != nil {
+					return err
+				}
+			}
+		}
+		if len(page) < PageSize {
+			return nil
+		}
+	}
+}
+
+func writeTarJSON(tw *tar.Writer, name string, v any, modTime time.Time) error {
+	content, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), ModTime: modTime}); err != nil {
+		return err
+	}
+	_, err = tw.Write(content)
+	return err
+}
+
+// ImportTar restores a tar archive written by ExportTar: the types first, then the items, their tags and links
+// the items are saved in chunks as they are read, see Import for the options; as the number of items is not known
+// in advance, OnProgress is called after each chunk with a total of -1
+func (c *Client) ImportTar(r io.Reader, opts ImportOptions) error {
+	chunkSize := opts.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = defaultImportChunkSize
+	}
+	progress := opts.OnProgress
+	imported := 0
+	chunkOpts := opts
+	chunkOpts.OnProgress = nil
+	var chunk IL
+	flush := func() error {
+		if len(chunk) == 0 {
+			return nil
+		}
+		if err := c.Import(chunk, chunkOpts); err != nil {
+			return err
+		}
+		imported += len(chunk)
+		if progress != nil {
+			progress(imported, -1)
+		}
+		chunk = nil
+		return nil
+	}
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("cannot read archive: %s", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			return fmt.Errorf("cannot read archive entry '%s': %s", header.Name, err)
+		}
+		switch {
+		case strings.HasPrefix(header.Name, "types/"):
+			typeInfo := new(TT)
+			if err = json.Unmarshal(content, typeInfo); err != nil {
+				return fmt.Errorf("cannot unmarshal archive entry '%s': %s", header.Name, err)
+			}
+			if err = c.putType(typeInfo); err != nil {
+				return err
+			}
+		case strings.HasPrefix(header.Name, "items/"):
+			chunk = append(chunk, I{Key: strings.TrimPrefix(header.Name, "items/"), Type: header.PAXRecords[tarTypeRecord], Value: content})
+			if len(chunk) >= chunkSize {
+				if err = flush(); err != nil {
+					return err
+				}
+			}
+		case strings.HasPrefix(header.Name, "tags/"):
+			if err = flush(); err != nil {
+				return err
+			}
+			var tags []T
+			if err = json.Unmarshal(content, &tags); err != nil {
+				return fmt.Errorf("cannot unmarshal archive entry '%s': %s", header.Name, err)
+			}
+			key := strings.TrimSuffix(strings.TrimPrefix(header.Name, "tags/"), ".json")
+			for _, tag := range tags {
+				if err = c.Tag(key, tag.Name, tag.Value); err != nil {
+					return err
+				}
+			}
+		case header.Name == "links.json":
+			if err = flush(); err != nil {
+				return err
+			}
+			var links []L
+			if err = json.Unmarshal(content, &links); err != nil {
+				return fmt.Errorf("cannot unmarshal archive entry '%s': %s", header.Name, err)
+			}
+			for _, link := range links {
+				if err = c.LinkWithAttributes(link.From, link.To, link.Attributes); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return flush()
+}
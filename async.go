@@ -0,0 +1,147 @@
+/*
+  Source Configuration Service
+  © 2022 Southwinds Tech Ltd - www.southwinds.io
+  Licensed under the Apache License, Version 2.0 at http://www.apache.org/licenses/LICENSE-2.0
+  Contributors to this project, hereby assign copyright in this code to the project,
+  to be licensed under the same terms as the rest of the code.
+*/
+
+package src
+
+import (
+	"errors"
+	"sync"
+)
+
+const (
+	// defaultAsyncWorkers the number of workers saving asynchronously if not specified in the client options
+	defaultAsyncWorkers = 4
+	// defaultAsyncQueueSize the number of asynchronous saves that can be queued if not specified in the client options
+	defaultAsyncQueueSize = 100
+)
+
+// ErrClosed returned when work is submitted to a client that has been closed
+var ErrClosed = errors.New("client is closed")
+
+// asyncSaver a bounded pool of workers saving items in the background
+type asyncSaver struct {
+	// lock guards closed and the sends to the queue
+	lock    sync.RWMutex
+	closed  bool
+	start   sync.Once
+	queue   chan asyncSave
+	workers sync.WaitGroup
+	// pending the number of saves queued or in progress, idle is signalled when it drops to zero
+	pendingLock sync.Mutex
+	pending     int
+	idle        *sync.Cond
+}
+
+// asyncSave a save waiting to be processed by a worker
+type asyncSave struct {
+	key, itemType string
+	value         []byte
+	result        chan error
+}
+
+func newAsyncSaver() *asyncSaver {
+	a := &asyncSaver{}
+	a.idle = sync.NewCond(&a.pendingLock)
+	return a
+}
+
+func (a *asyncSaver) add() {
+	a.pendingLock.Lock()
+	a.pending++
+	a.pendingLock.Unlock()
+}
+
+func (a *asyncSaver) done() {
+	a.pendingLock.Lock()
+	a.pending--
+	if a.pending == 0 {
+		a.idle.Broadcast()
+	}
+	a.pendingLock.Unlock()
+}
+
+// wait blocks until there are no saves queued or in progress
+func (a *asyncSaver) wait() {
+	a.pendingLock.Lock()
+	for a.pending > 0 {
+		a.idle.Wait()
+	}
+	a.pendingLock.Unlock()
+}
+
+// SaveAsync queues the item to be saved by a bounded pool of background workers
+// the returned channel receives the result of the save, nil if successful, and is then closed
+// the item is validated and any key wildcard completed before SaveAsync returns
+// if the queue is full, SaveAsync blocks until a worker frees a slot, applying backpressure to the caller
+// use Flush to wait for the queued saves to complete and Close before shutdown
+func (c *Client) SaveAsync(key, itemType string, item Valid) <-chan error {
+	result := make(chan error, 1)
+	key, value, err := c.prepareSave(key, itemType, item)
+	if err != nil {
+		result <- err
+		close(result)
+		return result
+	}
+	a := c.async
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	if a.closed {
+		result <- ErrClosed
+		close(result)
+		return result
+	}
+	a.start.Do(func() { c.startAsyncWorkers() })
+	a.add()
+	a.queue <- asyncSave{key: key, itemType: itemType, value: value, result: result}
+	return result
+}
+
+// startAsyncWorkers starts the workers processing the asynchronous saves
+func (c *Client) startAsyncWorkers() {
+	workers, size := c.opts.AsyncWorkers, c.opts.AsyncQueueSize
+	if workers <= 0 {
+		workers = defaultAsyncWorkers
+	}
+	if size <= 0 {
+		size = defaultAsyncQueueSize
+	}
+	a := c.async
+	a.queue = make(chan asyncSave, size)
+	for i := 0; i < workers; i++ {
+		a.workers.Add(1)
+		go func() {
+			defer a.workers.Done()
+			for save := range a.queue {
+				save.result <- c.saveRaw(save.key, save.itemType, save.value, nil)
+				close(save.result)
+				a.done()
+			}
+		}()
+	}
+}
+
+// waitAsync blocks until all queued asynchronous saves have completed
+func (c *Client) waitAsync() {
+	c.async.wait()
+}
+
+// closeAsync stops accepting asynchronous saves and lets the workers exit once the queue is drained
+func (c *Client) closeAsync() {
+	a := c.async
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.closed {
+		return
+	}
+	a.closed = true
+	// prevents the workers from starting after the client is closed
+	a.start.Do(func() {})
+	if a.queue != nil {
+		close(a.queue)
+	}
+}
@@ -10,29 +10,124 @@ package src
 
 import (
 	"bytes"
-	"crypto/tls"
+	"context"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/hashicorp/go-retryablehttp"
 	"github.com/invopop/jsonschema"
 	"io"
 	"net/http"
+	"net/url"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 var UserAgent = fmt.Sprintf("SW-SOURCE-CLIENT-%s", Version)
 
+var (
+	// PageSize the number of items requested per page by the methods that load all items page by page
+	PageSize = 500
+	// MaxLoadAllItems the maximum number of items the methods that load all items page by page can return
+	MaxLoadAllItems = 100000
+)
+
 type ClientOptions struct {
 	InsecureSkipVerify bool
-	Timeout            time.Duration
+	// Timeout the time limit of each attempt, at least MinTimeout, e.g. a few seconds to fail fast on an intranet
+	Timeout time.Duration
+	// RetryPolicy controls the wait between retries and the jitter applied to it
+	RetryPolicy RetryPolicy
+	// OnRetry is called each time a failed attempt is about to be retried
+	OnRetry OnRetryFunc `json:"-"`
+	// OnCall is called after each call to the source server completes, e.g. to record metrics such as histograms of
+	// the payload sizes by method and path; calls with a response are reported once its body is closed
+	OnCall CallHook `json:"-"`
+	// OnBody is called with the request and response bodies of each call, e.g. for a compliance audit trail
+	// it is off by default as it buffers the bodies, which are passed as sent and received, e.g. still compressed
+	OnBody BodyHook `json:"-"`
+	// Codec the serializer used for item values, defaults to encoding/json decoding numbers as json.Number
+	Codec Codec `json:"-"`
+	// Clock the source of the time used by the client, defaults to the system clock
+	// set it to control the time in tests, e.g. of the wildcard keys, cached schemas and polls
+	Clock Clock `json:"-"`
+	// KeyGenerator generates the value replacing the "?" wildcard in item keys, defaults to a UTC timestamp
+	// set it to return a fixed sequence in tests that need deterministic keys
+	KeyGenerator func() string `json:"-"`
+	// KeyRules the rules keys are checked against by ValidateKey, defaults to DefaultKeyRules
+	KeyRules *KeyRules `json:"-"`
+	// SchemaCacheTTL the time type schemas used for client-side validation are cached for, defaults to 5 minutes
+	SchemaCacheTTL time.Duration
+	// CoalesceInterval the minimum time between flushes of the items saved using SaveCoalesced, defaults to 1 second
+	CoalesceInterval time.Duration
+	// AsyncWorkers the number of workers processing the items saved using SaveAsync, defaults to 4
+	AsyncWorkers int
+	// AsyncQueueSize the number of items saved using SaveAsync that can wait for a worker, defaults to 100
+	AsyncQueueSize int
+	// MaxIdleConns the maximum number of idle connections kept open, defaults to 100
+	MaxIdleConns int
+	// MaxIdleConnsPerHost the maximum number of idle connections kept open to the source server, defaults to 32
+	// raise it along with MaxConnsPerHost for clients making many concurrent calls
+	MaxIdleConnsPerHost int
+	// MaxConnsPerHost the maximum number of connections to the source server, including those in use (0 = no limit)
+	MaxConnsPerHost int
+	// IdleConnTimeout the time an idle connection is kept open before being closed, defaults to 90 seconds
+	IdleConnTimeout time.Duration
+	// DisableHTTP2 forces HTTP/1.1 over TLS, e.g. behind proxies or load balancers mishandling HTTP/2 streams
+	// HTTP/2 is otherwise negotiated over TLS; plain text connections always use HTTP/1.1 as h2c is not supported
+	DisableHTTP2 bool
+	// StreamThreshold the size up to which values saved using SaveStream are buffered and retried, defaults to 8 MiB
+	// larger values are streamed in a single attempt without retries; a negative threshold streams every value
+	StreamThreshold int64
+	// MaxResponseBytes the maximum size of a response body once inflated, defaults to 100 MiB
+	// larger responses fail with a *ResponseTooLargeError rather than exhausting the memory of the client
+	MaxResponseBytes int64
+	// DisableRetry makes a single attempt per call, failing fast instead of retrying, e.g. on latency-critical paths
+	DisableRetry bool
+	// TypeHeader the name of the header carrying the item type when saving items, defaults to Source-Type
+	// e.g. for deployments behind a proxy rewriting headers
+	TypeHeader string
+	// AuthScheme the scheme of the Authorization header, defaults to Basic
+	// with any other scheme, e.g. Bearer, the password is sent as the credentials and the user is ignored
+	AuthScheme string
+	// CompressValues stores the values of 1 KiB or more saved by the client gzip-compressed, recording the encoding
+	// with the item so that loading it inflates the value again; unlike transport compression, the value stays
+	// compressed at rest; items saved uncompressed are loaded as they are, and streamed values are never compressed
+	CompressValues bool
+	// MethodOverride sends the requests other than GET and HEAD as POST, with the actual method in the
+	// X-HTTP-Method-Override header, e.g. behind proxies blocking PUT and DELETE; the server must honour the header
+	MethodOverride bool
+	// BestEffortTx lets Tx apply the operations one by one, reverting them if any fails, when the source server does
+	// not support transactions; the operations are then not atomic, so Tx otherwise fails with ErrUnsupported
+	BestEffortTx bool
+	// ReadOnly makes every call that would modify the store fail with a *ReadOnlyError without being sent,
+	// e.g. for services that must only consume configuration whatever the permissions of their credentials
+	ReadOnly bool
+	// DisableRedirects returns redirect responses to the caller instead of following them, which then fail the call
+	// e.g. to surface a misconfigured host rather than silently talking to another one
+	DisableRedirects bool
+	// RedirectAuthSameHost only sends the Authorization header when following redirects to the same scheme, host
+	// and port as the original request, instead of any subdomain of its host as net/http does
+	RedirectAuthSameHost bool
 }
 
+// MinTimeout the shortest timeout accepted, preventing a zero timeout failing every call
+const MinTimeout = time.Second
+
 func (o ClientOptions) Validate() error {
-	if o.Timeout < 30*time.Second {
-		return fmt.Errorf("timeout must be greater than 30 secs")
+	if o.Timeout < MinTimeout {
+		return fmt.Errorf("timeout must be at least %s", MinTimeout)
+	}
+	if o.KeyRules != nil {
+		return o.KeyRules.checkChars()
 	}
 	return nil
 }
@@ -47,6 +142,25 @@ func defaultOptions() *ClientOptions {
 type Client struct {
 	*retryablehttp.Client
 	host, token string
+	opts        ClientOptions
+	// headers additional headers sent on every request
+	headers http.Header
+	// list the options applied to the calls returning lists of items
+	list listOptions
+	// factories the item factories registered by item type
+	factories *factoryRegistry
+	// schemas the cached json schemas of item types
+	schemas *schemaCache
+	// coalescer buffers the items saved using SaveCoalesced
+	coalescer *coalescer
+	// async saves the items saved using SaveAsync
+	async *asyncSaver
+	// budget limits the retries made by all the calls of the client, nil if not limited
+	budget *retryBudget
+	// info caches the version and features of the source server
+	info *serverInfoCache
+	// last the stats of the last call made
+	last atomic.Pointer[CallStats]
 }
 
 func New(host, user, pwd string, opts *ClientOptions) *Client {
@@ -55,38 +169,172 @@ func New(host, user, pwd string, opts *ClientOptions) *Client {
 	}
 	c := retryablehttp.NewClient()
 	c.RetryMax = 20
+	if opts.DisableRetry {
+		c.RetryMax = 0
+	}
 	c.HTTPClient = &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: opts.InsecureSkipVerify,
-			},
-		},
+		Transport: newTransport(opts),
 		// set the client timeout period
-		Timeout: opts.Timeout,
-	}
-	return &Client{ // the http client instance
-		host:   host,
-		token:  basicToken(user, pwd),
-		Client: c,
-	}
+		Timeout:       opts.Timeout,
+		CheckRedirect: checkRedirect(opts),
+	}
+	if opts.RetryPolicy.MinWait > 0 {
+		c.RetryWaitMin = opts.RetryPolicy.MinWait
+	}
+	if opts.RetryPolicy.MaxWait > 0 {
+		c.RetryWaitMax = opts.RetryPolicy.MaxWait
+	}
+	client := &Client{ // the http client instance
+		host:      host,
+		token:     authToken(opts.AuthScheme, user, pwd),
+		Client:    c,
+		opts:      *opts,
+		headers:   http.Header{},
+		factories: newFactoryRegistry(),
+		schemas:   newSchemaCache(),
+		coalescer: newCoalescer(),
+		async:     newAsyncSaver(),
+		info:      &serverInfoCache{},
+	}
+	if client.opts.Clock == nil {
+		client.opts.Clock = realClock{}
+	}
+	client.budget = newRetryBudget(opts.RetryPolicy, client.opts.Clock)
+	if client.opts.Codec == nil {
+		client.opts.Codec = defaultCodec
+	}
+	if client.opts.KeyGenerator == nil {
+		clock := client.opts.Clock
+		client.opts.KeyGenerator = func() string { return timestampKey(clock) }
+	}
+	c.CheckRetry = client.checkRetry
+	c.Backoff = client.backoff
+	return client
 }
 
 func (c *Client) SetType(key string, obj any) error {
+	typeInfo, err := c.newTypeInfo(key, obj)
+	if err != nil {
+		return err
+	}
+	return c.putType(typeInfo)
+}
+
+// newTypeInfo the type information with the json schema reflected from the specified object
+func (c *Client) newTypeInfo(key string, obj any) (*TT, error) {
 	// reflects the json schema from the specified object
 	schemaObj := jsonschema.Reflect(obj)
 	schemaBytes, err := json.Marshal(schemaObj)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	protoBytes, err := json.Marshal(obj)
+	protoBytes, err := c.opts.Codec.Marshal(obj)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	typeInfo := &TT{
+	return &TT{
 		Key:    key,
 		Schema: schemaBytes,
 		Proto:  protoBytes,
+	}, nil
+}
+
+// SetTypes registers several types at once keyed by type key, e.g. to provision a new environment
+// the schemas are reflected and checked before any type is sent; if any fails, none is
+// registered and the failures are returned keyed by type key along with an error
+// the types are registered in a single request if the server supports it, otherwise concurrently one by one, in
+// which case the types that could not be registered are returned keyed by type key, nil if all were registered
+func (c *Client) SetTypes(types map[string]any) (map[string]error, error) {
+	keys := make([]string, 0, len(types))
+	for key := range types {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	infos := make([]*TT, len(keys))
+	failures := map[string]error{}
+	for i, key := range keys {
+		if len(key) == 0 {
+			failures[key] = fmt.Errorf("a type key is required")
+			continue
+		}
+		typeInfo, err := c.newTypeInfo(key, types[key])
+		if err == nil {
+			err = checkTypeInfo(typeInfo)
+		}
+		if err != nil {
+			failures[key] = err
+			continue
+		}
+		infos[i] = typeInfo
+	}
+	if len(failures) > 0 {
+		return failures, fmt.Errorf("cannot register types: %d of %d types are invalid", len(failures), len(keys))
+	}
+	registered, err := c.putTypes(infos)
+	if err != nil || registered {
+		return nil, err
+	}
+	var lock sync.Mutex
+	_ = fanOut(len(infos), defaultConcurrency, func(i int) error {
+		if putErr := c.putType(infos[i]); putErr != nil {
+			lock.Lock()
+			failures[infos[i].Key] = putErr
+			lock.Unlock()
+		}
+		return nil
+	})
+	if len(failures) == 0 {
+		return nil, nil
+	}
+	return failures, nil
+}
+
+// checkTypeInfo checks the schema of the type is valid by evaluating it against the prototype
+// the prototype is not required to conform as zero values, e.g. nil slices, are often left out of it
+func checkTypeInfo(typeInfo *TT) error {
+	var proto any
+	if err := defaultCodec.Unmarshal(typeInfo.Proto, &proto); err != nil {
+		return fmt.Errorf("cannot unmarshal prototype: %s", err)
+	}
+	v := &schemaValidator{root: typeInfo.Schema}
+	if err := v.validate(typeInfo.Schema, proto, ""); err != nil {
+		return fmt.Errorf("invalid schema: %s", err)
+	}
+	return nil
+}
+
+// putTypes registers the type information in a single request
+// returns false if the server responds it does not implement registering types in bulk
+func (c *Client) putTypes(infos []*TT) (bool, error) {
+	infoBytes, err := json.Marshal(infos)
+	if err != nil {
+		return false, err
+	}
+	request, err := retryablehttp.NewRequest(http.MethodPut, c.url("/types"), bytes.NewReader(infoBytes))
+	if err != nil {
+		return false, err
+	}
+	request.Header.Set("Authorization", c.token)
+	request.Header.Set("User-Agent", UserAgent)
+	resp, reqErr := c.do(request)
+	if reqErr != nil {
+		return false, reqErr
+	}
+	defer resp.Body.Close()
+	if notImplemented(resp.StatusCode) {
+		return false, nil
+	}
+	if resp.StatusCode > 299 {
+		return false, statusError(resp, "cannot set types")
+	}
+	for _, typeInfo := range infos {
+		c.InvalidateSchema(typeInfo.Key)
 	}
+	return true, nil
+}
+
+// putType registers the type information
+func (c *Client) putType(typeInfo *TT) error {
 	infoBytes, err := json.Marshal(typeInfo)
 	if err != nil {
 		return err
@@ -100,419 +348,2032 @@ func (c *Client) SetType(key string, obj any) error {
 	}
 	request.Header.Set("Authorization", c.token)
 	request.Header.Set("User-Agent", UserAgent)
-	resp, reqErr := c.Do(request)
+	resp, reqErr := c.do(request)
+	if reqErr != nil {
+		return reqErr
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode > 299 {
+		return statusError(resp, "cannot set type")
+	}
+	c.InvalidateSchema(typeInfo.Key)
+	return nil
+}
+
+// GetProto unmarshals the prototype the specified type was registered with into out
+// the prototype carries the example / default values of the type, e.g. to pre-fill new items
+// out must be a pointer; returns ErrNotFound if the type does not exist
+func (c *Client) GetProto(key string, out any) error {
+	if reflect.ValueOf(out).Kind() != reflect.Ptr {
+		return fmt.Errorf("out argument passed to GetProto() must be a pointer")
+	}
+	t, err := c.GetType(key)
+	if err != nil {
+		return err
+	}
+	if err = c.opts.Codec.Unmarshal(t.Proto, out); err != nil {
+		return fmt.Errorf("cannot unmarshal prototype of type '%s': %s", key, err)
+	}
+	return nil
+}
+
+// UpdateTypeProto updates the prototype of an existing type leaving its schema unchanged
+// use it when the default values of a type change but its structure does not
+// returns ErrNotFound if the type does not exist
+func (c *Client) UpdateTypeProto(key string, proto any) error {
+	protoBytes, err := c.opts.Codec.Marshal(proto)
+	if err != nil {
+		return err
+	}
+	request, err := retryablehttp.NewRequest(http.MethodPut, c.url("/type/%s/proto", key), bytes.NewReader(protoBytes))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", c.token)
+	request.Header.Set("User-Agent", UserAgent)
+	resp, reqErr := c.do(request)
+	if reqErr != nil {
+		return reqErr
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return notFoundError(resp, fmt.Sprintf("type '%s'", key))
+	}
+	if resp.StatusCode > 299 {
+		return statusError(resp, "cannot update type prototype")
+	}
+	return nil
+}
+
+// GetType the item type identified by key
+// returns ErrNotFound if the type does not exist
+func (c *Client) GetType(key string) (*TT, error) {
+	request, err := retryablehttp.NewRequest(http.MethodGet, c.url("/type/%s", key), nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Authorization", c.token)
+	request.Header.Set("User-Agent", UserAgent)
+	resp, reqErr := c.do(request)
+	if reqErr != nil {
+		return nil, reqErr
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, notFoundError(resp, fmt.Sprintf("type '%s'", key))
+	}
+	if resp.StatusCode > 299 {
+		return nil, statusError(resp, "cannot get type")
+	}
+	body, readErr := c.readBody(resp)
+	if readErr != nil {
+		return nil, fmt.Errorf("cannot read response body: %w", readErr)
+	}
+	typeInfo := new(TT)
+	err = json.Unmarshal(body, typeInfo)
+	if err != nil {
+		return nil, fmt.Errorf("cannot unmarshal response body: %s", err)
+	}
+	return typeInfo, nil
+}
+
+// ListTypes the item types registered in the source server
+func (c *Client) ListTypes() ([]TT, error) {
+	request, err := retryablehttp.NewRequest(http.MethodGet, c.url("/type"), nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Authorization", c.token)
+	request.Header.Set("User-Agent", UserAgent)
+	resp, reqErr := c.do(request)
+	if reqErr != nil {
+		return nil, reqErr
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode > 299 {
+		return nil, statusError(resp, "cannot list types")
+	}
+	body, readErr := c.readBody(resp)
+	if readErr != nil {
+		return nil, fmt.Errorf("cannot read response body: %w", readErr)
+	}
+	var types []TT
+	err = json.Unmarshal(body, &types)
+	if err != nil {
+		return nil, fmt.Errorf("cannot unmarshal response body: %s", err)
+	}
+	return types, nil
+}
+
+// Save the configuration item under the unique key using the validation defined by itemType
+func (c *Client) Save(key, itemType string, item Valid) error {
+	key, value, err := c.prepareSave(key, itemType, item)
+	if err != nil {
+		return err
+	}
+	return c.saveRaw(key, itemType, value, nil)
+}
+
+// SaveWithMeta saves the configuration item recording who made the change and why
+// the metadata is returned in the Author and Reason fields of the item when loaded
+func (c *Client) SaveWithMeta(key, itemType string, item Valid, meta SaveMeta) error {
+	key, value, err := c.prepareSave(key, itemType, item)
+	if err != nil {
+		return err
+	}
+	return c.saveRaw(key, itemType, value, meta.headers())
+}
+
+// SaveIfNotExists saves the configuration item only if no item with the key exists, e.g. for idempotent provisioning
+// returns an *AlreadyExistsError if it exists; if the save is retried after an attempt whose response was lost,
+// the item that attempt created is recognised by its content and the save succeeds instead
+func (c *Client) SaveIfNotExists(key, itemType string, item Valid) error {
+	key, value, err := c.prepareSave(key, itemType, item)
+	if err != nil {
+		return err
+	}
+	err = c.saveRaw(key, itemType, value, http.Header{"If-None-Match": []string{"*"}})
+	var exists *AlreadyExistsError
+	if !errors.As(err, &exists) || !exists.retried {
+		return err
+	}
+	if stored, loadErr := c.LoadRaw(key, ConsistentRead()); loadErr == nil && stored.Type == itemType && sameContent(stored.Value, value) {
+		return nil
+	}
+	return err
+}
+
+// SaveIfChanged saves the configuration item only if its type or the content of its value differs from the one stored
+// returns true if the item was saved, including when it did not exist, and false if the save was skipped
+// it avoids needless writes, and new versions, when reconciling items that rarely change
+func (c *Client) SaveIfChanged(key, itemType string, item Valid) (bool, error) {
+	key, value, err := c.prepareSave(key, itemType, item)
+	if err != nil {
+		return false, err
+	}
+	current, err := c.LoadRaw(key)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return false, err
+	}
+	if current != nil && current.Type == itemType {
+		currentHash, hashErr := contentHash(current.Value)
+		if hashErr != nil {
+			return false, hashErr
+		}
+		newHash, hashErr := contentHash(value)
+		if hashErr != nil {
+			return false, hashErr
+		}
+		if currentHash == newHash {
+			return false, nil
+		}
+	}
+	if err = c.saveRaw(key, itemType, value, nil); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// SaveVerified saves the configuration item and reads it back to confirm the value stored is the one sent
+// returns a *VerificationError if it differs, e.g. because the server transformed or partially wrote the value
+// members the server adds to the value are tolerated; it costs an extra consistent read per save
+func (c *Client) SaveVerified(key, itemType string, item Valid) error {
+	key, value, err := c.prepareSave(key, itemType, item)
+	if err != nil {
+		return err
+	}
+	if err = c.saveRaw(key, itemType, value, nil); err != nil {
+		return err
+	}
+	stored, err := c.LoadRaw(key, ConsistentRead())
+	if err != nil {
+		return fmt.Errorf("cannot verify item '%s': %w", key, err)
+	}
+	sentHash, err := contentHash(value)
+	if err != nil {
+		return err
+	}
+	if storedHash, hashErr := contentHash(stored.Value); hashErr == nil && storedHash == sentHash {
+		return nil
+	}
+	diff, err := DiffJSON(value, stored.Value)
+	if err != nil {
+		return &VerificationError{Key: key, Cause: err}
+	}
+	var changes []JSONChange
+	for _, change := range diff.Changes {
+		if change.Op != "add" {
+			changes = append(changes, change)
+		}
+	}
+	if len(changes) > 0 {
+		return &VerificationError{Key: key, Changes: changes}
+	}
+	return nil
+}
+
+// sameContent true if both json values have the same content regardless of their formatting
+func sameContent(a, b []byte) bool {
+	hashA, err := contentHash(a)
+	if err != nil {
+		return false
+	}
+	hashB, err := contentHash(b)
+	return err == nil && hashA == hashB
+}
+
+// contentHash the sha256 hash of a json value ignoring the formatting and the order of the object members
+func contentHash(value []byte) (string, error) {
+	var v any
+	if err := defaultCodec.Unmarshal(value, &v); err != nil {
+		return "", fmt.Errorf("cannot unmarshal value: %s", err)
+	}
+	// maps are marshalled with sorted keys
+	canonical, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(canonical)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// expandKey replaces the first wildcard "?" in the key, if any, with a key from the KeyGenerator
+func (c *Client) expandKey(key string) string {
+	if !strings.Contains(key, "?") {
+		return key
+	}
+	return strings.Replace(key, "?", c.opts.KeyGenerator(), 1)
+}
+
+// prepareSave validates the item, completes any key wildcard and serializes the item value
+func (c *Client) prepareSave(key, itemType string, item Valid) (string, []byte, error) {
+	if err := item.Validate(); err != nil {
+		return "", nil, err
+	}
+	if reflect.ValueOf(item).Kind() == reflect.Ptr {
+		return "", nil, fmt.Errorf("item argument passed to Save() must not be a pointer")
+	}
+	if len(itemType) == 0 {
+		return "", nil, fmt.Errorf("item type is required to validate the item data")
+	}
+	key = c.expandKey(key)
+	objBytes, err := c.opts.Codec.Marshal(item)
+	if err != nil {
+		return "", nil, err
+	}
+	return key, objBytes, nil
+}
+
+// saveRaw puts the serialized item value sending the specified additional headers
+// returns a *ConflictError if the headers make the save conditional on an If-Match version that has changed,
+// or an *AlreadyExistsError if they make it conditional on If-None-Match and the item exists
+func (c *Client) saveRaw(key, itemType string, value []byte, headers http.Header) error {
+	value, headers, err := c.compressValue(value, headers)
+	if err != nil {
+		return err
+	}
+	ctx, state := withRetryState(context.Background(), c.opts.Clock)
+	request, err := retryablehttp.NewRequestWithContext(ctx, http.MethodPut, c.url("/item/%s", key), bytes.NewReader(value))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", c.token)
+	request.Header.Set("User-Agent", UserAgent)
+	if len(itemType) > 0 {
+		request.Header.Set(c.typeHeader(), itemType)
+	}
+	for name, values := range headers {
+		request.Header[name] = values
+	}
+	resp, reqErr := c.do(request)
+	if reqErr != nil {
+		return reqErr
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusPreconditionFailed && len(request.Header.Get("If-Match")) > 0 {
+		return &ConflictError{Key: key, Version: request.Header.Get("If-Match"), retried: state.attempts > 1}
+	}
+	if resp.StatusCode == http.StatusPreconditionFailed && len(request.Header.Get("If-None-Match")) > 0 {
+		return &AlreadyExistsError{Key: key, retried: state.attempts > 1}
+	}
+	if resp.StatusCode > 299 {
+		statusErr := statusError(resp, "cannot save item")
+		body, err := c.readBody(resp)
+		if err == nil && len(body) > 0 {
+			statusErr.Message = string(body)
+		}
+		return statusErr
+	}
+	return nil
+}
+
+// LoadRaw the raw configuration item identified by key
+func (c *Client) LoadRaw(itemKey string, opts ...ReadOption) (*I, error) {
+	return c.LoadRawContext(context.Background(), itemKey, opts...)
+}
+
+// LoadRawContext the raw configuration item identified by key, see LoadRaw
+// the read, including its retries, is abandoned once the context is done
+func (c *Client) LoadRawContext(ctx context.Context, itemKey string, opts ...ReadOption) (*I, error) {
+	item, _, err := c.loadRaw(ctx, itemKey, readHeaders(opts))
+	return item, err
+}
+
+// LoadRawIfModifiedSince the raw configuration item identified by key if it was modified after the specified time
+// use the Updated time of a previously loaded item to poll for changes cheaply
+// modified is false, and the item nil, if the server responds 304 Not Modified
+func (c *Client) LoadRawIfModifiedSince(itemKey string, t time.Time) (item *I, modified bool, err error) {
+	item, resp, err := c.loadRaw(context.Background(), itemKey, http.Header{"If-Modified-Since": []string{t.UTC().Format(http.TimeFormat)}})
+	if err != nil {
+		return nil, false, err
+	}
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, false, nil
+	}
+	return item, true, nil
+}
+
+// loadRaw gets the item sending the specified additional headers
+// the item is nil if the server responds 304 Not Modified
+func (c *Client) loadRaw(ctx context.Context, itemKey string, headers http.Header) (*I, *http.Response, error) {
+	request, err := retryablehttp.NewRequestWithContext(ctx, http.MethodGet, c.url("/item/%s", itemKey), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	request.Header.Set("Authorization", c.token)
+	request.Header.Set("User-Agent", UserAgent)
+	for name, values := range headers {
+		request.Header[name] = values
+	}
+	resp, reqErr := c.do(request)
+	if reqErr != nil {
+		return nil, nil, reqErr
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, resp, nil
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, resp, notFoundError(resp, fmt.Sprintf("item '%s'", itemKey))
+	}
+	if resp.StatusCode > 299 {
+		return nil, resp, statusError(resp, "cannot get item")
+	}
+	body, readErr := c.readBody(resp)
+	if readErr != nil {
+		return nil, resp, fmt.Errorf("cannot read response body: %w", readErr)
+	}
+	if len(body) == 0 {
+		return nil, resp, &EmptyResponseError{Method: http.MethodGet, Path: request.URL.Path, Status: resp.Status}
+	}
+	item := new(I)
+	err = c.opts.Codec.Unmarshal(body, item)
+	if err != nil {
+		return nil, resp, fmt.Errorf("cannot unmarshal response body: %s", err)
+	}
+	// the server might only report the version via the entity tag
+	if len(item.Version) == 0 {
+		item.Version = resp.Header.Get("ETag")
+	}
+	if etag, etagErr := ParseETag(resp.Header.Get("ETag")); etagErr == nil {
+		item.ETag = &etag
+	}
+	if len(item.ContentType) == 0 {
+		item.ContentType = resp.Header.Get("Source-Content-Type")
+	}
+	if len(item.Encoding) == 0 {
+		item.Encoding = resp.Header.Get(valueEncodingHeader)
+	}
+	if err = c.received(item); err != nil {
+		return nil, resp, err
+	}
+	// hides a soft-deleted item in case the server returned it
+	if item.Deleted && len(headers.Get(includeDeletedHeader)) == 0 {
+		return nil, resp, fmt.Errorf("item '%s': %w", itemKey, ErrNotFound)
+	}
+	return item, resp, nil
+}
+
+// LoadAuto the value of the item decoded according to its content type:
+// json values are unmarshalled into generic maps, slices and values, any other content is returned as []byte
+// so that stores mixing json items and raw blobs can be read without knowing the format in advance
+func (c *Client) LoadAuto(key string) (any, error) {
+	item, err := c.LoadRaw(key)
+	if err != nil {
+		return nil, err
+	}
+	if !item.IsJSON() {
+		return item.Value, nil
+	}
+	var value any
+	if err = item.unmarshal(&value); err != nil {
+		return nil, fmt.Errorf("cannot unmarshal value of item '%s': %s", key, err)
+	}
+	return value, nil
+}
+
+// Exists true if an item with the specified key exists
+func (c *Client) Exists(itemKey string) (bool, error) {
+	return c.exists(context.Background(), itemKey)
+}
+
+func (c *Client) exists(ctx context.Context, itemKey string) (bool, error) {
+	request, err := retryablehttp.NewRequestWithContext(ctx, http.MethodHead, c.url("/item/%s", itemKey), nil)
+	if err != nil {
+		return false, err
+	}
+	request.Header.Set("Authorization", c.token)
+	request.Header.Set("User-Agent", UserAgent)
+	resp, reqErr := c.do(request)
+	if reqErr != nil {
+		return false, reqErr
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if resp.StatusCode > 299 {
+		return false, statusError(resp, "cannot check item exists")
+	}
+	return true, nil
+}
+
+// ExistsBatch which of the items identified by the specified keys exist, keyed by item key
+// the keys are checked using a bounded number of concurrent calls
+func (c *Client) ExistsBatch(keys []string) (map[string]bool, error) {
+	return c.ExistsBatchContext(context.Background(), keys)
+}
+
+// ExistsBatchContext is ExistsBatch stopping as soon as the context is done
+func (c *Client) ExistsBatchContext(ctx context.Context, keys []string) (map[string]bool, error) {
+	var lock sync.Mutex
+	exists := make(map[string]bool, len(keys))
+	err := fanOut(len(keys), defaultConcurrency, func(i int) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		found, err := c.exists(ctx, keys[i])
+		if err != nil {
+			return err
+		}
+		lock.Lock()
+		exists[keys[i]] = found
+		lock.Unlock()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return exists, nil
+}
+
+// Load the typed configuration item identified by key using the specified item prototype
+// The prototype is an empty instance of the type to get
+// If the prototype is nil, it is created using the factory registered for the item type
+func (c *Client) Load(itemKey string, prototype any, opts ...ReadOption) (any, error) {
+	return c.LoadContext(context.Background(), itemKey, prototype, opts...)
+}
+
+// LoadContext the typed configuration item identified by key, see Load
+// the read, including its retries, is abandoned once the context is done
+func (c *Client) LoadContext(ctx context.Context, itemKey string, prototype any, opts ...ReadOption) (any, error) {
+	if prototype != nil && reflect.ValueOf(prototype).Kind() != reflect.Ptr {
+		return nil, fmt.Errorf("prototype argument passed to Load() must be a pointer")
+	}
+	i, err := c.LoadRawContext(ctx, itemKey, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if prototype == nil {
+		items, typedErr := c.typed(IL{*i}, nil)
+		if typedErr != nil {
+			return nil, typedErr
+		}
+		return items[0], nil
+	}
+	return i.Typed(prototype)
+}
+
+// LoadOrDefault the typed configuration item identified by key, see Load, or def if the item does not exist
+// only failures other than the item not being found are returned as errors
+func (c *Client) LoadOrDefault(itemKey string, prototype any, def any) (any, error) {
+	item, err := c.Load(itemKey, prototype)
+	if errors.Is(err, ErrNotFound) {
+		return def, nil
+	}
+	return item, err
+}
+
+// LoadField the value found at the specified RFC 6901 JSON Pointer within the configuration item identified by key
+// e.g. "/spec/replicas" or "/hosts/0"; an empty pointer returns the whole value
+func (c *Client) LoadField(itemKey, jsonPointer string) (json.RawMessage, error) {
+	i, err := c.LoadRaw(itemKey)
+	if err != nil {
+		return nil, err
+	}
+	return resolvePointer(i.Value, jsonPointer)
+}
+
+// LoadItemsByTagRaw the items having the specified tags
+// the tags are sent to the source server joined by "|" and how they combine is decided by the server,
+// use LoadItemsByTagQueryRaw to select items using explicit AND / OR semantics
+func (c *Client) LoadItemsByTagRaw(tags ...string) (IL, error) {
+	request, err := retryablehttp.NewRequest(http.MethodGet, c.listURL(nil, "/item/tag/%s", strings.Join(tags, "|")), nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Authorization", c.token)
+	request.Header.Set("User-Agent", UserAgent)
+	c.setListHeaders(request)
+	resp, reqErr := c.do(request)
+	if reqErr != nil {
+		return nil, reqErr
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode > 299 {
+		return nil, statusError(resp, "cannot get tagged items")
+	}
+	body, readErr := c.readBody(resp)
+	if readErr != nil {
+		return nil, fmt.Errorf("cannot read response body: %w", readErr)
+	}
+	if len(body) == 0 {
+		return nil, nil
+	}
+	var items IL
+	err = c.opts.Codec.Unmarshal(body, &items)
+	if err != nil {
+		return nil, fmt.Errorf("cannot unmarshal response body: %s", err)
+	}
+	return c.listed(items)
+}
+
+func (c *Client) LoadItemsByTag(factory func() any, tags ...string) ([]any, error) {
+	items, err := c.LoadItemsByTagRaw(tags...)
+	if err != nil {
+		return nil, err
+	}
+	return c.typed(items, factory)
+}
+
+// LoadItemsByTagMap the items having the specified tags converted using the factory, keyed by item key
+func (c *Client) LoadItemsByTagMap(factory func() any, tags ...string) (map[string]any, error) {
+	items, err := c.LoadItemsByTagRaw(tags...)
+	if err != nil {
+		return nil, err
+	}
+	return c.typedMap(items, factory)
+}
+
+// LoadItemsByTypeRaw the items of the specified type
+// the order of the items is unspecified unless sorting is requested using WithSort
+func (c *Client) LoadItemsByTypeRaw(itemType string) (IL, error) {
+	request, err := retryablehttp.NewRequest(http.MethodGet, c.listURL(nil, "/item/type/%s", itemType), nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Authorization", c.token)
+	request.Header.Set("User-Agent", UserAgent)
+	c.setListHeaders(request)
+	resp, reqErr := c.do(request)
+	if reqErr != nil {
+		return nil, reqErr
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode > 299 {
+		return nil, statusError(resp, fmt.Sprintf("cannot get item for type '%s'", itemType))
+	}
+	body, readErr := c.readBody(resp)
+	if readErr != nil {
+		return nil, fmt.Errorf("cannot read response body: %w", readErr)
+	}
+	if len(body) == 0 {
+		return nil, nil
+	}
+	var items IL
+	err = c.opts.Codec.Unmarshal(body, &items)
+	if err != nil {
+		return nil, fmt.Errorf("cannot unmarshal response body: %s", err)
+	}
+	return c.listed(items)
+}
+
+func (c *Client) LoadItemsByType(factory func() any, itemType string) ([]any, error) {
+	items, err := c.LoadItemsByTypeRaw(itemType)
+	if err != nil {
+		return nil, err
+	}
+	return c.typed(items, factory)
+}
+
+// LoadItemsByTypeMap the items of the specified type converted using the factory, keyed by item key
+func (c *Client) LoadItemsByTypeMap(factory func() any, itemType string) (map[string]any, error) {
+	items, err := c.LoadItemsByTypeRaw(itemType)
+	if err != nil {
+		return nil, err
+	}
+	return c.typedMap(items, factory)
+}
+
+// LoadItemsWithoutTag the items of the specified type not carrying the named tag, converted using the factory
+// e.g. for compliance checks such as every item having an owner tag, see LoadItemsWithoutTagRaw for its cost
+func (c *Client) LoadItemsWithoutTag(factory func() any, itemType, tagName string) ([]any, error) {
+	items, err := c.LoadItemsWithoutTagRaw(itemType, tagName)
+	if err != nil {
+		return nil, err
+	}
+	return c.typed(items, factory)
+}
+
+// LoadItemsWithoutTagRaw the raw items of the specified type not carrying the named tag
+// it is computed client-side: all the items of the type are loaded, see LoadAllByType, then their tags using a
+// bounded number of concurrent calls, so it costs about one call per item and is meant for periodic checks
+func (c *Client) LoadItemsWithoutTagRaw(itemType, tagName string) (IL, error) {
+	if len(tagName) == 0 {
+		return nil, fmt.Errorf("a tag name is required")
+	}
+	items, err := c.LoadAllByType(itemType)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, len(items))
+	for i, item := range items {
+		keys[i] = item.Key
+	}
+	tags, err := c.GetTagsBatch(keys)
+	if err != nil {
+		return nil, err
+	}
+	var result IL
+	for _, item := range items {
+		var tagged bool
+		for _, tag := range tags[item.Key] {
+			if tag.Name == tagName {
+				tagged = true
+				break
+			}
+		}
+		if !tagged {
+			result = append(result, item)
+		}
+	}
+	return result, nil
+}
+
+// LoadItemsByTypes the items of all the specified types, loaded using a bounded number of concurrent calls
+// the items are returned grouped in the order of the types, and an item returned for more than one type only once
+// factory receives the type of each item to create the value it is converted to; if nil, the registered factories are used
+func (c *Client) LoadItemsByTypes(factory func(itemType string) any, itemTypes ...string) ([]any, error) {
+	results := make([]IL, len(itemTypes))
+	err := fanOut(len(itemTypes), defaultConcurrency, func(i int) error {
+		items, err := c.LoadItemsByTypeRaw(itemTypes[i])
+		results[i] = items
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	var combined IL
+	seen := map[string]bool{}
+	for _, items := range results {
+		for _, item := range items {
+			if !seen[item.Key] {
+				seen[item.Key] = true
+				combined = append(combined, item)
+			}
+		}
+	}
+	if factory == nil {
+		return c.typed(combined, nil)
+	}
+	ii := make([]any, 0, len(combined))
+	for _, item := range combined {
+		itemType := item.Type
+		i, convErr := convert(item, func() any { return factory(itemType) })
+		if convErr != nil {
+			return nil, convErr
+		}
+		ii = append(ii, i)
+	}
+	return ii, nil
+}
+
+// LoadItemsByTypePage a page of the items of the specified type
+// offset: the number of items to skip, limit: the maximum number of items in the page
+func (c *Client) LoadItemsByTypePage(itemType string, offset, limit int) (IL, error) {
+	return c.loadItemsByTypePage(context.Background(), itemType, offset, limit)
+}
+
+func (c *Client) loadItemsByTypePage(ctx context.Context, itemType string, offset, limit int) (IL, error) {
+	if offset < 0 || limit <= 0 {
+		return nil, fmt.Errorf("invalid page: offset must not be negative and limit must be positive")
+	}
+	query := url.Values{"offset": []string{strconv.Itoa(offset)}, "limit": []string{strconv.Itoa(limit)}}
+	request, err := retryablehttp.NewRequestWithContext(ctx, http.MethodGet, c.listURL(query, "/item/type/%s", itemType), nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Authorization", c.token)
+	request.Header.Set("User-Agent", UserAgent)
+	c.setListHeaders(request)
+	resp, reqErr := c.do(request)
+	if reqErr != nil {
+		return nil, reqErr
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode > 299 {
+		return nil, statusError(resp, fmt.Sprintf("cannot get page of items for type '%s'", itemType))
+	}
+	body, readErr := c.readBody(resp)
+	if readErr != nil {
+		return nil, fmt.Errorf("cannot read response body: %w", readErr)
+	}
+	if len(body) == 0 {
+		return nil, nil
+	}
+	var items IL
+	err = c.opts.Codec.Unmarshal(body, &items)
+	if err != nil {
+		return nil, fmt.Errorf("cannot unmarshal response body: %s", err)
+	}
+	return c.listed(items)
+}
+
+// nextCursorHeader the response header carrying the cursor of the next page, empty on the last page
+const nextCursorHeader = "Source-Next-Cursor"
+
+// LoadItemsByTypeCursor a page of the items of the specified type starting at the cursor, empty for the first page
+// returns the cursor of the next page, empty once there are no more items
+// unlike offsets, cursors do not skip or repeat items when items are saved or deleted while paging
+// returns ErrUnsupported if the source server does not page using cursors, use LoadItemsByTypePage instead
+func (c *Client) LoadItemsByTypeCursor(itemType, cursor string, limit int) (IL, string, error) {
+	items, next, supported, err := c.loadItemsByTypeCursor(context.Background(), itemType, cursor, limit)
+	if err != nil {
+		return nil, "", err
+	}
+	if !supported {
+		return nil, "", ErrUnsupported
+	}
+	return items, next, nil
+}
+
+// loadItemsByTypeCursor a page of the items starting at the cursor
+// supported is false if the server did not return a cursor, in which case it returned the first page by offset
+func (c *Client) loadItemsByTypeCursor(ctx context.Context, itemType, cursor string, limit int) (items IL, next string, supported bool, err error) {
+	if limit <= 0 {
+		return nil, "", false, fmt.Errorf("invalid page: limit must be positive")
+	}
+	query := url.Values{"cursor": []string{cursor}, "limit": []string{strconv.Itoa(limit)}}
+	request, err := retryablehttp.NewRequestWithContext(ctx, http.MethodGet, c.listURL(query, "/item/type/%s", itemType), nil)
+	if err != nil {
+		return nil, "", false, err
+	}
+	request.Header.Set("Authorization", c.token)
+	request.Header.Set("User-Agent", UserAgent)
+	c.setListHeaders(request)
+	resp, reqErr := c.do(request)
+	if reqErr != nil {
+		return nil, "", false, reqErr
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode > 299 {
+		return nil, "", false, statusError(resp, fmt.Sprintf("cannot get page of items for type '%s'", itemType))
+	}
+	// the header is set, even if empty, by servers paging using cursors
+	_, supported = resp.Header[nextCursorHeader]
+	next = resp.Header.Get(nextCursorHeader)
+	body, readErr := c.readBody(resp)
+	if readErr != nil {
+		return nil, "", false, fmt.Errorf("cannot read response body: %w", readErr)
+	}
+	if len(body) == 0 {
+		return nil, next, supported, nil
+	}
+	err = c.opts.Codec.Unmarshal(body, &items)
+	if err != nil {
+		return nil, "", false, fmt.Errorf("cannot unmarshal response body: %s", err)
+	}
+	if items, err = c.listed(items); err != nil {
+		return nil, "", false, err
+	}
+	return items, next, supported, nil
+}
+
+// LoadAllByType all the items of the specified type retrieved page by page
+// pages by cursor if the source server supports it, falling back to paging by offset if it only supports offsets
+// it fails if the number of items exceeds MaxLoadAllItems to prevent unbounded memory use
+func (c *Client) LoadAllByType(itemType string) (IL, error) {
+	return c.LoadAllByTypeContext(context.Background(), itemType)
+}
+
+// LoadAllByTypeContext same as LoadAllByType stopping between pages if the context is cancelled
+func (c *Client) LoadAllByTypeContext(ctx context.Context, itemType string) (IL, error) {
+	all, next, supported, err := c.loadItemsByTypeCursor(ctx, itemType, "", PageSize)
+	if err != nil {
+		return nil, err
+	}
+	if supported {
+		for len(next) > 0 {
+			if err = ctx.Err(); err != nil {
+				return nil, err
+			}
+			var page IL
+			if page, next, _, err = c.loadItemsByTypeCursor(ctx, itemType, next, PageSize); err != nil {
+				return nil, err
+			}
+			all = append(all, page...)
+			if len(all) > MaxLoadAllItems {
+				return nil, fmt.Errorf("cannot load all items for type '%s': more than %d items", itemType, MaxLoadAllItems)
+			}
+		}
+		return all, nil
+	}
+	// the server pages by offset and returned the first page
+	if len(all) < PageSize {
+		return all, nil
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		page, err := c.loadItemsByTypePage(ctx, itemType, len(all), PageSize)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, page...)
+		if len(all) > MaxLoadAllItems {
+			return nil, fmt.Errorf("cannot load all items for type '%s': more than %d items", itemType, MaxLoadAllItems)
+		}
+		if len(page) < PageSize {
+			return all, nil
+		}
+	}
+}
+
+// Count the number of items of the specified type
+func (c *Client) Count(itemType string) (int, error) {
+	request, err := retryablehttp.NewRequest(http.MethodGet, c.url("/item/type/%s/count", itemType), nil)
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Authorization", c.token)
+	request.Header.Set("User-Agent", UserAgent)
+	resp, reqErr := c.do(request)
+	if reqErr != nil {
+		return 0, reqErr
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode > 299 {
+		return 0, statusError(resp, fmt.Sprintf("cannot count items for type '%s'", itemType))
+	}
+	body, readErr := c.readBody(resp)
+	if readErr != nil {
+		return 0, fmt.Errorf("cannot read response body: %w", readErr)
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(string(body)))
+	if err != nil {
+		return 0, fmt.Errorf("cannot parse item count: %s", err)
+	}
+	return count, nil
+}
+
+// LoadUpdatedSince the items of the specified type updated after the since time
+// the boundary is exclusive: an item updated exactly at since is not returned, so to sync incrementally, items
+// updated in the same millisecond as the last one synced are only returned by LoadUpdatedAfter
+// since is converted to UTC as the item Updated time is recorded in UTC; items are returned oldest first, then by key
+func (c *Client) LoadUpdatedSince(itemType string, since time.Time) (IL, error) {
+	since = since.UTC()
+	query := url.Values{"since": []string{since.Format(time.RFC3339Nano)}}
+	return c.loadUpdated(itemType, query, fmt.Sprintf("since '%s'", since), func(item I) bool {
+		return item.Updated.After(since)
+	})
+}
+
+// LoadUpdatedAfter the items of the specified type updated after the (since, key) cursor, i.e. after since or
+// exactly at since with a key greater than key, e.g. passing the Updated time and key of the last item synced
+// incrementally so that the items updated in the same millisecond after it are not skipped
+// since is converted to UTC as the item Updated time is recorded in UTC; items are returned oldest first, then by key
+func (c *Client) LoadUpdatedAfter(itemType string, since time.Time, key string) (IL, error) {
+	since = since.UTC()
+	query := url.Values{"from": []string{since.Format(time.RFC3339Nano)}, "tiebreak": []string{TieBreakByKey}}
+	return c.loadUpdated(itemType, query, fmt.Sprintf("after '%s' and key '%s'", since, key), func(item I) bool {
+		return item.Updated.After(since) || (item.Updated.Equal(since) && item.Key > key)
+	})
+}
+
+// loadUpdated the items of the type matching the time query sorted oldest first, then by key
+// the items are filtered using include in case the server ignored the query
+func (c *Client) loadUpdated(itemType string, query url.Values, desc string, include func(item I) bool) (IL, error) {
+	request, err := retryablehttp.NewRequest(http.MethodGet, c.url("/item/type/%s?%s", itemType, query.Encode()), nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Authorization", c.token)
+	request.Header.Set("User-Agent", UserAgent)
+	c.setListHeaders(request)
+	resp, reqErr := c.do(request)
+	if reqErr != nil {
+		return nil, reqErr
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode > 299 {
+		return nil, statusError(resp, fmt.Sprintf("cannot get items updated %s for type '%s'", desc, itemType))
+	}
+	body, readErr := c.readBody(resp)
+	if readErr != nil {
+		return nil, fmt.Errorf("cannot read response body: %w", readErr)
+	}
+	if len(body) == 0 {
+		return nil, nil
+	}
+	var items IL
+	err = c.opts.Codec.Unmarshal(body, &items)
+	if err != nil {
+		return nil, fmt.Errorf("cannot unmarshal response body: %s", err)
+	}
+	var result IL
+	for _, item := range items {
+		if include(item) {
+			result = append(result, item)
+		}
+	}
+	if result, err = c.listed(result); err != nil {
+		return nil, err
+	}
+	sortByUpdated(result)
+	return result, nil
+}
+
+// UpdatedBetween the items of the specified type updated within the window [from, to)
+// from is inclusive and to is exclusive, so that consecutive windows, e.g. week by week, neither overlap nor miss items
+// both bounds are converted to UTC as the item Updated time is recorded in UTC; items are returned oldest first,
+// then by key
+func (c *Client) UpdatedBetween(itemType string, from, to time.Time) (IL, error) {
+	from, to = from.UTC(), to.UTC()
+	if !from.Before(to) {
+		return nil, fmt.Errorf("invalid time window: from '%s' must be before to '%s'", from, to)
+	}
+	query := url.Values{"from": []string{from.Format(time.RFC3339Nano)}, "to": []string{to.Format(time.RFC3339Nano)}}
+	request, err := retryablehttp.NewRequest(http.MethodGet, c.url("/item/type/%s?%s", itemType, query.Encode()), nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Authorization", c.token)
+	request.Header.Set("User-Agent", UserAgent)
+	c.setListHeaders(request)
+	resp, reqErr := c.do(request)
+	if reqErr != nil {
+		return nil, reqErr
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode > 299 {
+		return nil, statusError(resp, fmt.Sprintf("cannot get items updated between '%s' and '%s' for type '%s'", from, to, itemType))
+	}
+	body, readErr := c.readBody(resp)
+	if readErr != nil {
+		return nil, fmt.Errorf("cannot read response body: %w", readErr)
+	}
+	if len(body) == 0 {
+		return nil, nil
+	}
+	var items IL
+	err = c.opts.Codec.Unmarshal(body, &items)
+	if err != nil {
+		return nil, fmt.Errorf("cannot unmarshal response body: %s", err)
+	}
+	// filters out any item outside the window in case the server ignored the query
+	var result IL
+	for _, item := range items {
+		if !item.Updated.Before(from) && item.Updated.Before(to) {
+			result = append(result, item)
+		}
+	}
+	if result, err = c.listed(result); err != nil {
+		return nil, err
+	}
+	sortByUpdated(result)
+	return result, nil
+}
+
+// Search the items whose value matches the query
+// the results carry the item key and type so that the full item can be retrieved using Load
+// returns ErrUnsupported if the source server does not offer search
+func (c *Client) Search(query string, opts SearchOptions) (IL, error) {
+	if len(query) == 0 {
+		return nil, fmt.Errorf("a search query is required")
+	}
+	request, err := retryablehttp.NewRequest(http.MethodGet, c.url("/search?%s", opts.query(query).Encode()), nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Authorization", c.token)
+	request.Header.Set("User-Agent", UserAgent)
+	c.setListHeaders(request)
+	resp, reqErr := c.do(request)
+	if reqErr != nil {
+		return nil, reqErr
+	}
+	defer resp.Body.Close()
+	if unsupported(resp.StatusCode) {
+		return nil, ErrUnsupported
+	}
+	if resp.StatusCode > 299 {
+		return nil, statusError(resp, "cannot search items")
+	}
+	body, readErr := c.readBody(resp)
+	if readErr != nil {
+		return nil, fmt.Errorf("cannot read response body: %w", readErr)
+	}
+	if len(body) == 0 {
+		return nil, nil
+	}
+	var items IL
+	err = c.opts.Codec.Unmarshal(body, &items)
+	if err != nil {
+		return nil, fmt.Errorf("cannot unmarshal response body: %s", err)
+	}
+	return c.listed(items)
+}
+
+// PopOldestRaw removes and returns the least recently updated item of the specified type, nil if there are none
+// items updated at the same time are popped in ascending key order, see TieBreakByKey
+func (c *Client) PopOldestRaw(itemType string) (*I, error) {
+	return c.popRaw("oldest", itemType)
+}
+
+// popRaw removes and returns the item at the specified end of the items of the type, nil if there are none
+// soft-deleted items are popped and skipped, unless the list options include them
+func (c *Client) popRaw(end, itemType string) (*I, error) {
+	for {
+		item, err := c.popOnce(end, itemType)
+		if err != nil || item == nil || !item.Deleted || c.list.includeDeleted {
+			return item, err
+		}
+	}
+}
+
+// popOnce removes and returns the item at the specified end of the items of the type, nil if there are none
+func (c *Client) popOnce(end, itemType string) (*I, error) {
+	request, err := retryablehttp.NewRequest(http.MethodDelete, c.url("/item/pop/%s/%s?tiebreak=%s", end, itemType, TieBreakByKey), nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Authorization", c.token)
+	request.Header.Set("User-Agent", UserAgent)
+	c.setListHeaders(request)
+	resp, reqErr := c.do(request)
+	if reqErr != nil {
+		return nil, reqErr
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode > 299 {
+		return nil, statusError(resp, "cannot get item")
+	}
+	body, readErr := c.readBody(resp)
+	if readErr != nil {
+		return nil, fmt.Errorf("cannot read response body: %w", readErr)
+	}
+	// an empty body means there is no item to pop
+	if len(body) == 0 {
+		return nil, nil
+	}
+	item := new(I)
+	err = c.opts.Codec.Unmarshal(body, item)
+	if err != nil {
+		return nil, fmt.Errorf("cannot unmarshal response body: %s", err)
+	}
+	if err = c.received(item); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func (c *Client) PopOldest(itemType string, prototype any) (any, error) {
+	if reflect.ValueOf(prototype).Kind() != reflect.Ptr {
+		return nil, fmt.Errorf("prototype argument passed to PopOldest() must be a pointer")
+	}
+	i, err := c.PopOldestRaw(itemType)
+	if err != nil {
+		return nil, err
+	}
+	if i == nil {
+		return nil, nil
+	}
+	return i.Typed(prototype)
+}
+
+// PopNewestRaw removes and returns the most recently updated item of the specified type, nil if there are none
+// items updated at the same time are popped in descending key order, see TieBreakByKey
+func (c *Client) PopNewestRaw(itemType string) (*I, error) {
+	return c.popRaw("newest", itemType)
+}
+
+func (c *Client) PopNewest(itemType string, prototype any) (any, error) {
+	if reflect.ValueOf(prototype).Kind() != reflect.Ptr {
+		return nil, fmt.Errorf("prototype argument passed to PopNewest() must be a pointer")
+	}
+	i, err := c.PopNewestRaw(itemType)
+	if err != nil {
+		return nil, err
+	}
+	if i == nil {
+		return nil, nil
+	}
+	return i.Typed(prototype)
+}
+
+func (c *Client) LoadChildrenRaw(itemKey string) (IL, error) {
+	request, err := retryablehttp.NewRequest(http.MethodGet, c.listURL(nil, "/item/%s/children", itemKey), nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Authorization", c.token)
+	request.Header.Set("User-Agent", UserAgent)
+	c.setListHeaders(request)
+	resp, reqErr := c.do(request)
+	if reqErr != nil {
+		return nil, reqErr
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode > 299 {
+		return nil, statusError(resp, "cannot get children for item")
+	}
+	body, readErr := c.readBody(resp)
+	if readErr != nil {
+		return nil, fmt.Errorf("cannot read response body: %w", readErr)
+	}
+	if len(body) == 0 {
+		return nil, nil
+	}
+	var items IL
+	err = c.opts.Codec.Unmarshal(body, &items)
+	if err != nil {
+		return nil, fmt.Errorf("cannot unmarshal response body: %s", err)
+	}
+	return c.listed(items)
+}
+
+func (c *Client) LoadChildren(factory func() any, itemKey string) ([]any, error) {
+	items, err := c.LoadChildrenRaw(itemKey)
+	if err != nil {
+		return nil, err
+	}
+	return c.typed(items, factory)
+}
+
+// LoadChildrenMap the children of the item converted using the factory, keyed by item key
+func (c *Client) LoadChildrenMap(factory func() any, itemKey string) (map[string]any, error) {
+	items, err := c.LoadChildrenRaw(itemKey)
+	if err != nil {
+		return nil, err
+	}
+	return c.typedMap(items, factory)
+}
+
+func (c *Client) LoadParentsRaw(itemKey string) (IL, error) {
+	request, err := retryablehttp.NewRequest(http.MethodGet, c.listURL(nil, "/item/%s/parents", itemKey), nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Authorization", c.token)
+	request.Header.Set("User-Agent", UserAgent)
+	c.setListHeaders(request)
+	resp, reqErr := c.do(request)
+	if reqErr != nil {
+		return nil, reqErr
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode > 299 {
+		return nil, statusError(resp, "cannot get parents for item")
+	}
+	body, readErr := c.readBody(resp)
+	if readErr != nil {
+		return nil, fmt.Errorf("cannot read response body: %w", readErr)
+	}
+	if len(body) == 0 {
+		return nil, nil
+	}
+	var items IL
+	err = c.opts.Codec.Unmarshal(body, &items)
+	if err != nil {
+		return nil, fmt.Errorf("cannot unmarshal response body: %s", err)
+	}
+	return c.listed(items)
+}
+
+func (c *Client) LoadParents(factory func() any, itemKey string) ([]any, error) {
+	items, err := c.LoadParentsRaw(itemKey)
+	if err != nil {
+		return nil, err
+	}
+	return c.typed(items, factory)
+}
+
+// LoadParentsMap the parents of the item converted using the factory, keyed by item key
+func (c *Client) LoadParentsMap(factory func() any, itemKey string) (map[string]any, error) {
+	items, err := c.LoadParentsRaw(itemKey)
+	if err != nil {
+		return nil, err
+	}
+	return c.typedMap(items, factory)
+}
+
+// RelationAttribute the link attribute holding the relationship label used by the ByRelation methods
+const RelationAttribute = "relation"
+
+// LoadChildrenByRelationRaw the children of the item linked from it using the specified relation
+// the relation is the value of the RelationAttribute of the link; if no link has it the result is empty
+func (c *Client) LoadChildrenByRelationRaw(itemKey, relation string) (IL, error) {
+	return c.loadByRelation(itemKey, relation, true)
+}
+
+func (c *Client) LoadChildrenByRelation(factory func() any, itemKey, relation string) ([]any, error) {
+	items, err := c.LoadChildrenByRelationRaw(itemKey, relation)
+	if err != nil {
+		return nil, err
+	}
+	return c.typed(items, factory)
+}
+
+// LoadParentsByRelationRaw the parents of the item linked to it using the specified relation
+// the relation is the value of the RelationAttribute of the link; if no link has it the result is empty
+func (c *Client) LoadParentsByRelationRaw(itemKey, relation string) (IL, error) {
+	return c.loadByRelation(itemKey, relation, false)
+}
+
+func (c *Client) LoadParentsByRelation(factory func() any, itemKey, relation string) ([]any, error) {
+	items, err := c.LoadParentsByRelationRaw(itemKey, relation)
+	if err != nil {
+		return nil, err
+	}
+	return c.typed(items, factory)
+}
+
+// loadByRelation loads the children or parents of the item keeping only those linked using the relation
+func (c *Client) loadByRelation(itemKey, relation string, children bool) (IL, error) {
+	links, err := c.GetLinks(itemKey)
+	if err != nil {
+		return nil, err
+	}
+	related := map[string]bool{}
+	for _, link := range links {
+		if link.Attributes[RelationAttribute] != relation {
+			continue
+		}
+		if children && link.From == itemKey {
+			related[link.To] = true
+		} else if !children && link.To == itemKey {
+			related[link.From] = true
+		}
+	}
+	if len(related) == 0 {
+		return nil, nil
+	}
+	var items IL
+	if children {
+		items, err = c.LoadChildrenRaw(itemKey)
+	} else {
+		items, err = c.LoadParentsRaw(itemKey)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var result IL
+	for _, item := range items {
+		if related[item.Key] {
+			result = append(result, item)
+		}
+	}
+	return result, nil
+}
+
+func (c *Client) Tag(itemKey, tagName, tagValue string) error {
+	var tag string
+	if len(tagName) > 0 {
+		if len(tagValue) > 0 {
+			tag = fmt.Sprintf("%s|%s", tagName, tagValue)
+		} else {
+			tag = tagName
+		}
+	} else {
+		return fmt.Errorf("a tag name is required")
+	}
+	request, err := retryablehttp.NewRequest(http.MethodPut, c.url("/item/%s/tag/%s", itemKey, tag), nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", c.token)
+	request.Header.Set("User-Agent", UserAgent)
+	resp, reqErr := c.do(request)
+	if reqErr != nil {
+		return reqErr
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode > 299 {
+		return statusError(resp, "cannot tag item")
+	}
+	return nil
+}
+
+func (c *Client) Untag(itemKey, tagName string) error {
+	if len(tagName) == 0 {
+		return fmt.Errorf("a tag name is required")
+	}
+	request, err := retryablehttp.NewRequest(http.MethodDelete, c.url("/item/%s/tag/%s", itemKey, tagName), nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", c.token)
+	request.Header.Set("User-Agent", UserAgent)
+	resp, reqErr := c.do(request)
 	if reqErr != nil {
 		return reqErr
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode > 299 {
-		return fmt.Errorf("cannot set type, source server responded with: %s", resp.Status)
+		return statusError(resp, "cannot tag item")
 	}
 	return nil
 }
 
-// Save the configuration item under the unique key using the validation defined by itemType
-func (c *Client) Save(key, itemType string, item Valid) error {
-	if err := item.Validate(); err != nil {
-		return err
-	}
-	if reflect.ValueOf(item).Kind() == reflect.Ptr {
-		return fmt.Errorf("item argument passed to Save() must not be a pointer")
+// UntagMany removes the specified tags from the item identified by key, e.g. when relabelling it
+// the tags are removed concurrently; tags the item does not have are skipped as already removed
+// returns the tags that could not be removed keyed by tag name, nil if all were removed, and an error if the
+// tags of the item could not be read
+func (c *Client) UntagMany(itemKey string, tagNames ...string) (map[string]error, error) {
+	tags, err := c.GetTags(itemKey)
+	if err != nil {
+		return nil, err
 	}
-	if len(itemType) == 0 {
-		return fmt.Errorf("item type is required to validate the item data")
+	tagged := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tagged[tag.Name] = true
 	}
-	// if the key contains a wildcard
-	if strings.Contains(key, "?") {
-		// generates sequence
-		now := time.Now().UTC().Format("20060102150405.000")
-		key = strings.Replace(key, "?", now, 1)
+	var names []string
+	for _, name := range tagNames {
+		if len(name) == 0 {
+			return nil, fmt.Errorf("a tag name is required")
+		}
+		if tagged[name] {
+			names = append(names, name)
+			// removes duplicated names once
+			tagged[name] = false
+		}
 	}
-	objBytes, err := json.Marshal(item)
+	var (
+		lock     sync.Mutex
+		failures map[string]error
+	)
+	_ = fanOut(len(names), defaultConcurrency, func(i int) error {
+		if untagErr := c.Untag(itemKey, names[i]); untagErr != nil {
+			lock.Lock()
+			if failures == nil {
+				failures = map[string]error{}
+			}
+			failures[names[i]] = untagErr
+			lock.Unlock()
+		}
+		return nil
+	})
+	return failures, nil
+}
+
+// UntagAll removes every tag from the item identified by key
+func (c *Client) UntagAll(itemKey string) error {
+	tags, err := c.GetTags(itemKey)
 	if err != nil {
 		return err
 	}
-	request, err := retryablehttp.NewRequest(http.MethodPut, c.url("/item/%s", key), bytes.NewReader(objBytes))
+	names := make([]string, len(tags))
+	for i, tag := range tags {
+		names[i] = tag.Name
+	}
+	failures, err := c.UntagMany(itemKey, names...)
 	if err != nil {
 		return err
 	}
-	request.Header.Set("Authorization", c.token)
-	request.Header.Set("User-Agent", UserAgent)
-	if len(itemType) > 0 {
-		request.Header.Set("Source-Type", itemType)
-	}
-	resp, reqErr := c.Do(request)
-	if reqErr != nil {
-		return reqErr
-	}
-	if resp.StatusCode > 299 {
-		var msg string
-		body, err := io.ReadAll(resp.Body)
-		if err == nil && len(body) > 0 {
-			msg = string(body[:])
+	sort.Strings(names)
+	var errs []error
+	for _, name := range names {
+		if failures[name] != nil {
+			errs = append(errs, fmt.Errorf("cannot remove tag '%s': %w", name, failures[name]))
 		}
-		return fmt.Errorf("cannot save item, source server responded with: %s, %s", resp.Status, msg)
 	}
-	return nil
+	return joinErrors(errs)
 }
 
-// LoadRaw the raw configuration item identified by key
-func (c *Client) LoadRaw(itemKey string) (*I, error) {
-	request, err := retryablehttp.NewRequest(http.MethodGet, c.url("/item/%s", itemKey), nil)
+// GetTags the tags of the item identified by key
+func (c *Client) GetTags(itemKey string) ([]T, error) {
+	request, err := retryablehttp.NewRequest(http.MethodGet, c.url("/item/%s/tag", itemKey), nil)
 	if err != nil {
 		return nil, err
 	}
 	request.Header.Set("Authorization", c.token)
 	request.Header.Set("User-Agent", UserAgent)
-	resp, reqErr := c.Do(request)
+	resp, reqErr := c.do(request)
 	if reqErr != nil {
 		return nil, reqErr
 	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, notFoundError(resp, fmt.Sprintf("item '%s'", itemKey))
+	}
 	if resp.StatusCode > 299 {
-		return nil, fmt.Errorf("cannot get item, source server responded with: %s", resp.Status)
+		return nil, statusError(resp, "cannot get item tags")
 	}
-	body, readErr := io.ReadAll(resp.Body)
+	body, readErr := c.readBody(resp)
 	if readErr != nil {
-		return nil, fmt.Errorf("cannot read response body: %s", readErr)
+		return nil, fmt.Errorf("cannot read response body: %w", readErr)
 	}
-	item := new(I)
-	err = json.Unmarshal(body, item)
+	var tags []T
+	err = json.Unmarshal(body, &tags)
 	if err != nil {
 		return nil, fmt.Errorf("cannot unmarshal response body: %s", err)
 	}
-	return item, nil
+	return tags, nil
 }
 
-// Load the typed configuration item identified by key using the specified item prototype
-// The prototype is an empty instance of the type to get
-func (c *Client) Load(itemKey string, prototype any) (any, error) {
-	if reflect.ValueOf(prototype).Kind() != reflect.Ptr {
-		return nil, fmt.Errorf("prototype argument passed to Load() must be a pointer")
-	}
-	i, err := c.LoadRaw(itemKey)
+// GetTagsBatch the tags of the items identified by the specified keys, keyed by item key
+// items without tags map to an empty slice, keys of items that do not exist are omitted
+// if the server has no batch endpoint, the tags are retrieved using a bounded number of concurrent calls
+func (c *Client) GetTagsBatch(keys []string) (map[string][]T, error) {
+	keysBytes, err := json.Marshal(keys)
 	if err != nil {
 		return nil, err
 	}
-	return i.Typed(prototype)
-}
-
-func (c *Client) LoadItemsByTagRaw(tags ...string) (IL, error) {
-	request, err := retryablehttp.NewRequest(http.MethodGet, c.url("/item/tag/%s", strings.Join(tags, "|")), nil)
+	request, err := retryablehttp.NewRequest(http.MethodPost, c.url("/item/tag/batch"), bytes.NewReader(keysBytes))
 	if err != nil {
 		return nil, err
 	}
 	request.Header.Set("Authorization", c.token)
 	request.Header.Set("User-Agent", UserAgent)
-	resp, reqErr := c.Do(request)
+	request.Header.Set("Content-Type", "application/json")
+	resp, reqErr := c.do(request)
 	if reqErr != nil {
 		return nil, reqErr
 	}
+	defer resp.Body.Close()
+	if unsupported(resp.StatusCode) {
+		return c.getTagsFanOut(keys)
+	}
 	if resp.StatusCode > 299 {
-		return nil, fmt.Errorf("cannot get tagged items, source server responded with: %s", resp.Status)
+		return nil, statusError(resp, "cannot get tags for items")
 	}
-	body, readErr := io.ReadAll(resp.Body)
+	body, readErr := c.readBody(resp)
 	if readErr != nil {
-		return nil, fmt.Errorf("cannot read response body: %s", readErr)
+		return nil, fmt.Errorf("cannot read response body: %w", readErr)
 	}
-	var items IL
-	err = json.Unmarshal(body, &items)
+	tags := map[string][]T{}
+	err = json.Unmarshal(body, &tags)
 	if err != nil {
 		return nil, fmt.Errorf("cannot unmarshal response body: %s", err)
 	}
-	return items, nil
+	for key, itemTags := range tags {
+		if itemTags == nil {
+			tags[key] = []T{}
+		}
+	}
+	return tags, nil
 }
 
-func (c *Client) LoadItemsByTag(factory func() any, tags ...string) ([]any, error) {
-	items, err := c.LoadItemsByTagRaw(tags...)
+// getTagsFanOut gets the tags of each item concurrently
+func (c *Client) getTagsFanOut(keys []string) (map[string][]T, error) {
+	var lock sync.Mutex
+	tags := make(map[string][]T, len(keys))
+	err := fanOut(len(keys), defaultConcurrency, func(i int) error {
+		itemTags, err := c.GetTags(keys[i])
+		if errors.Is(err, ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if itemTags == nil {
+			itemTags = []T{}
+		}
+		lock.Lock()
+		tags[keys[i]] = itemTags
+		lock.Unlock()
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	return items.Typed(factory)
+	return tags, nil
 }
 
-func (c *Client) LoadItemsByTypeRaw(itemType string) (IL, error) {
-	request, err := retryablehttp.NewRequest(http.MethodGet, c.url("/item/type/%s", itemType), nil)
+// HasTag true if the item identified by key carries the named tag
+func (c *Client) HasTag(itemKey, tagName string) (bool, error) {
+	_, found, err := c.GetTagValue(itemKey, tagName)
+	return found, err
+}
+
+// GetTagValue the value of the named tag of the item identified by key
+// found is false if the item does not carry the tag, which distinguishes it from a tag with an empty value
+func (c *Client) GetTagValue(itemKey, tagName string) (value string, found bool, err error) {
+	if len(tagName) == 0 {
+		return "", false, fmt.Errorf("a tag name is required")
+	}
+	tags, err := c.GetTags(itemKey)
 	if err != nil {
-		return nil, err
+		return "", false, err
 	}
-	request.Header.Set("Authorization", c.token)
-	request.Header.Set("User-Agent", UserAgent)
-	resp, reqErr := c.Do(request)
-	if reqErr != nil {
-		return nil, reqErr
+	for _, tag := range tags {
+		if tag.Name == tagName {
+			return tag.Value, true, nil
+		}
 	}
-	if resp.StatusCode > 299 {
-		return nil, fmt.Errorf("cannot get item for type '%s', source server responded with: %s", itemType, resp.Status)
+	return "", false, nil
+}
+
+// TagIfChanged tags the item only if it does not carry the tag or carries it with a different value
+// returns true if the item was tagged and false if the write was skipped, e.g. to avoid tag churn when
+// reconciling tags that rarely change
+func (c *Client) TagIfChanged(itemKey, tagName, tagValue string) (bool, error) {
+	current, found, err := c.GetTagValue(itemKey, tagName)
+	if err != nil {
+		return false, err
 	}
-	body, readErr := io.ReadAll(resp.Body)
-	if readErr != nil {
-		return nil, fmt.Errorf("cannot read response body: %s", readErr)
+	if found && current == tagValue {
+		return false, nil
 	}
-	var items IL
-	err = json.Unmarshal(body, &items)
-	if err != nil {
-		return nil, fmt.Errorf("cannot unmarshal response body: %s", err)
+	if err = c.Tag(itemKey, tagName, tagValue); err != nil {
+		return false, err
 	}
-	return items, nil
+	return true, nil
 }
 
-func (c *Client) LoadItemsByType(factory func() any, itemType string) ([]any, error) {
-	items, err := c.LoadItemsByTypeRaw(itemType)
-	if err != nil {
-		return nil, err
+// ListTagNames the distinct names of the tags in use, sorted, e.g. to build tag filters
+// returns ErrUnsupported if the source server cannot aggregate tags; computing them client-side
+// requires retrieving the tags of every item, which is not recommended for large stores
+func (c *Client) ListTagNames() ([]string, error) {
+	return c.listTagVocabulary(c.url("/tag"))
+}
+
+// ListTagValues the distinct values of the named tag in use, sorted
+// returns ErrUnsupported if the source server cannot aggregate tags
+func (c *Client) ListTagValues(tagName string) ([]string, error) {
+	if len(tagName) == 0 {
+		return nil, fmt.Errorf("a tag name is required")
 	}
-	return items.Typed(factory)
+	return c.listTagVocabulary(c.url("/tag/%s/values", tagName))
 }
 
-func (c *Client) PopOldestRaw(itemType string) (*I, error) {
-	request, err := retryablehttp.NewRequest(http.MethodDelete, c.url("/item/pop/oldest/%s", itemType), nil)
+func (c *Client) listTagVocabulary(requestURL string) ([]string, error) {
+	request, err := retryablehttp.NewRequest(http.MethodGet, requestURL, nil)
 	if err != nil {
 		return nil, err
 	}
 	request.Header.Set("Authorization", c.token)
 	request.Header.Set("User-Agent", UserAgent)
-	resp, reqErr := c.Do(request)
+	resp, reqErr := c.do(request)
 	if reqErr != nil {
 		return nil, reqErr
 	}
-	if resp.StatusCode == http.StatusNotFound {
-		return nil, nil
+	defer resp.Body.Close()
+	if unsupported(resp.StatusCode) {
+		return nil, ErrUnsupported
 	}
 	if resp.StatusCode > 299 {
-		return nil, fmt.Errorf("cannot get item, source server responded with: %s", resp.Status)
+		return nil, statusError(resp, "cannot list tags")
 	}
-	body, readErr := io.ReadAll(resp.Body)
+	body, readErr := c.readBody(resp)
 	if readErr != nil {
-		return nil, fmt.Errorf("cannot read response body: %s", readErr)
+		return nil, fmt.Errorf("cannot read response body: %w", readErr)
 	}
-	item := new(I)
-	err = json.Unmarshal(body, item)
+	if len(body) == 0 {
+		return nil, nil
+	}
+	var values []string
+	err = json.Unmarshal(body, &values)
 	if err != nil {
 		return nil, fmt.Errorf("cannot unmarshal response body: %s", err)
 	}
-	return item, nil
+	sort.Strings(values)
+	return values, nil
 }
 
-func (c *Client) PopOldest(itemType string, prototype any) (any, error) {
-	if reflect.ValueOf(prototype).Kind() != reflect.Ptr {
-		return nil, fmt.Errorf("prototype argument passed to PopOldest() must be a pointer")
+// SetAnnotations replaces the annotations of the item identified by key
+// annotations are structured key/value metadata kept separate from tags
+func (c *Client) SetAnnotations(itemKey string, annotations map[string]string) error {
+	if annotations == nil {
+		annotations = map[string]string{}
 	}
-	i, err := c.PopOldestRaw(itemType)
+	annBytes, err := json.Marshal(annotations)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	if i == nil {
-		return nil, nil
+	request, err := retryablehttp.NewRequest(http.MethodPut, c.url("/item/%s/annotations", itemKey), bytes.NewReader(annBytes))
+	if err != nil {
+		return err
 	}
-	return i.Typed(prototype)
+	request.Header.Set("Authorization", c.token)
+	request.Header.Set("User-Agent", UserAgent)
+	request.Header.Set("Content-Type", "application/json")
+	resp, reqErr := c.do(request)
+	if reqErr != nil {
+		return reqErr
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode > 299 {
+		return statusError(resp, "cannot set item annotations")
+	}
+	return nil
 }
 
-func (c *Client) PopNewestRaw(itemType string) (*I, error) {
-	request, err := retryablehttp.NewRequest(http.MethodDelete, c.url("/item/pop/newest/%s", itemType), nil)
+// GetAnnotations the annotations of the item identified by key
+func (c *Client) GetAnnotations(itemKey string) (map[string]string, error) {
+	request, err := retryablehttp.NewRequest(http.MethodGet, c.url("/item/%s/annotations", itemKey), nil)
 	if err != nil {
 		return nil, err
 	}
 	request.Header.Set("Authorization", c.token)
 	request.Header.Set("User-Agent", UserAgent)
-	resp, reqErr := c.Do(request)
+	resp, reqErr := c.do(request)
 	if reqErr != nil {
 		return nil, reqErr
 	}
-	if resp.StatusCode == http.StatusNotFound {
-		return nil, nil
-	}
+	defer resp.Body.Close()
 	if resp.StatusCode > 299 {
-		return nil, fmt.Errorf("cannot get item, source server responded with: %s", resp.Status)
+		return nil, statusError(resp, "cannot get item annotations")
 	}
-	body, readErr := io.ReadAll(resp.Body)
+	body, readErr := c.readBody(resp)
 	if readErr != nil {
-		return nil, fmt.Errorf("cannot read response body: %s", readErr)
+		return nil, fmt.Errorf("cannot read response body: %w", readErr)
 	}
-	item := new(I)
-	err = json.Unmarshal(body, item)
-	if err != nil {
-		return nil, fmt.Errorf("cannot unmarshal response body: %s", err)
+	annotations := map[string]string{}
+	if len(body) > 0 {
+		err = json.Unmarshal(body, &annotations)
+		if err != nil {
+			return nil, fmt.Errorf("cannot unmarshal response body: %s", err)
+		}
 	}
-	return item, nil
+	return annotations, nil
 }
 
-func (c *Client) PopNewest(itemType string, prototype any) (any, error) {
-	if reflect.ValueOf(prototype).Kind() != reflect.Ptr {
-		return nil, fmt.Errorf("prototype argument passed to PopNewest() must be a pointer")
+func (c *Client) Link(fromKey, toKey string) error {
+	return c.LinkWithAttributes(fromKey, toKey, nil)
+}
+
+// LinkWithAttributes links two items recording the specified attributes on the link
+// attributes describe the relationship, e.g. {"relation": "depends-on", "weight": "10"}
+func (c *Client) LinkWithAttributes(fromKey, toKey string, attrs map[string]string) error {
+	var body io.Reader
+	if len(attrs) > 0 {
+		attrBytes, err := json.Marshal(attrs)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(attrBytes)
 	}
-	i, err := c.PopOldestRaw(itemType)
+	request, err := retryablehttp.NewRequest(http.MethodPut, c.url("/link/%s/to/%s", fromKey, toKey), body)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	if i == nil {
-		return i, nil
+	request.Header.Set("Authorization", c.token)
+	request.Header.Set("User-Agent", UserAgent)
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
 	}
-	return i.Typed(prototype)
+	resp, reqErr := c.do(request)
+	if reqErr != nil {
+		return reqErr
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode > 299 {
+		return statusError(resp, "cannot link items")
+	}
+	return nil
 }
 
-func (c *Client) LoadChildrenRaw(itemKey string) (IL, error) {
-	request, err := retryablehttp.NewRequest(http.MethodGet, c.url("/item/%s/children", itemKey), nil)
+// GetLinks the links from and to the item identified by key, including their attributes
+func (c *Client) GetLinks(itemKey string) ([]L, error) {
+	request, err := retryablehttp.NewRequest(http.MethodGet, c.url("/item/%s/link", itemKey), nil)
 	if err != nil {
 		return nil, err
 	}
 	request.Header.Set("Authorization", c.token)
 	request.Header.Set("User-Agent", UserAgent)
-	resp, reqErr := c.Do(request)
+	resp, reqErr := c.do(request)
 	if reqErr != nil {
 		return nil, reqErr
 	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, notFoundError(resp, fmt.Sprintf("item '%s'", itemKey))
+	}
 	if resp.StatusCode > 299 {
-		return nil, fmt.Errorf("cannot get children for item, source server responded with: %s", resp.Status)
+		return nil, statusError(resp, "cannot get item links")
 	}
-	body, readErr := io.ReadAll(resp.Body)
+	body, readErr := c.readBody(resp)
 	if readErr != nil {
-		return nil, fmt.Errorf("cannot read response body: %s", readErr)
+		return nil, fmt.Errorf("cannot read response body: %w", readErr)
 	}
-	var items IL
-	err = json.Unmarshal(body, &items)
-	if err != nil {
-		return nil, fmt.Errorf("cannot unmarshal response body: %s", err)
+	if len(body) == 0 {
+		return nil, nil
 	}
-	return items, nil
-}
-
-func (c *Client) LoadChildren(factory func() any, itemKey string) ([]any, error) {
-	items, err := c.LoadChildrenRaw(itemKey)
+	var links []L
+	err = json.Unmarshal(body, &links)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("cannot unmarshal response body: %s", err)
 	}
-	return items.Typed(factory)
+	return links, nil
 }
 
-func (c *Client) LoadParentsRaw(itemKey string) (IL, error) {
-	request, err := retryablehttp.NewRequest(http.MethodGet, c.url("/item/%s/parents", itemKey), nil)
+// ListLinks all the links in the source server
+func (c *Client) ListLinks() ([]L, error) {
+	request, err := retryablehttp.NewRequest(http.MethodGet, c.url("/link"), nil)
 	if err != nil {
 		return nil, err
 	}
 	request.Header.Set("Authorization", c.token)
 	request.Header.Set("User-Agent", UserAgent)
-	resp, reqErr := c.Do(request)
+	resp, reqErr := c.do(request)
 	if reqErr != nil {
 		return nil, reqErr
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode > 299 {
-		return nil, fmt.Errorf("cannot get parents for item, source server responded with: %s", resp.Status)
+		return nil, statusError(resp, "cannot list links")
 	}
-	body, readErr := io.ReadAll(resp.Body)
+	body, readErr := c.readBody(resp)
 	if readErr != nil {
-		return nil, fmt.Errorf("cannot read response body: %s", readErr)
+		return nil, fmt.Errorf("cannot read response body: %w", readErr)
 	}
-	var items IL
-	err = json.Unmarshal(body, &items)
-	if err != nil {
-		return nil, fmt.Errorf("cannot unmarshal response body: %s", err)
+	if len(body) == 0 {
+		return nil, nil
 	}
-	return items, nil
-}
-
-func (c *Client) LoadParents(factory func() any, itemKey string) ([]any, error) {
-	items, err := c.LoadParentsRaw(itemKey)
+	var links []L
+	err = json.Unmarshal(body, &links)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("cannot unmarshal response body: %s", err)
 	}
-	return items.Typed(factory)
+	return links, nil
 }
 
-func (c *Client) Tag(itemKey, tagName, tagValue string) error {
-	var tag string
-	if len(tagName) > 0 {
-		if len(tagValue) > 0 {
-			tag = fmt.Sprintf("%s|%s", tagName, tagValue)
-		} else {
-			tag = tagName
-		}
-	} else {
-		return fmt.Errorf("a tag name is required")
-	}
-	request, err := retryablehttp.NewRequest(http.MethodPut, c.url("/item/%s/tag/%s", itemKey, tag), nil)
+func (c *Client) Unlink(fromKey, toKey string) error {
+	request, err := retryablehttp.NewRequest(http.MethodDelete, c.url("/link/%s/to/%s", fromKey, toKey), nil)
 	if err != nil {
 		return err
 	}
 	request.Header.Set("Authorization", c.token)
 	request.Header.Set("User-Agent", UserAgent)
-	resp, reqErr := c.Do(request)
+	resp, reqErr := c.do(request)
 	if reqErr != nil {
 		return reqErr
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode > 299 {
-		return fmt.Errorf("cannot tag item, source server responded with: %s", resp.Status)
+		return statusError(resp, "cannot unlink items")
 	}
 	return nil
 }
 
-func (c *Client) Untag(itemKey, tagName string) error {
-	if len(tagName) == 0 {
-		return fmt.Errorf("a tag name is required")
-	}
-	request, err := retryablehttp.NewRequest(http.MethodDelete, c.url("/item/%s/tag/%s", itemKey, tagName), nil)
+func (c *Client) Delete(key string) error {
+	request, err := retryablehttp.NewRequest(http.MethodDelete, c.url("/item/%s", key), nil)
 	if err != nil {
 		return err
 	}
 	request.Header.Set("Authorization", c.token)
 	request.Header.Set("User-Agent", UserAgent)
-	resp, reqErr := c.Do(request)
+	resp, reqErr := c.do(request)
 	if reqErr != nil {
 		return reqErr
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode > 299 {
-		return fmt.Errorf("cannot tag item, source server responded with: %s", resp.Status)
+		return statusError(resp, "cannot delete item")
 	}
 	return nil
 }
 
-func (c *Client) Link(fromKey, toKey string) error {
-	request, err := retryablehttp.NewRequest(http.MethodPut, c.url("/link/%s/to/%s", fromKey, toKey), nil)
+// DeleteIfMatch deletes the item only if its version matches the specified version (see I.Version)
+// returns a *ConflictError if the item has been modified since the version was read
+func (c *Client) DeleteIfMatch(key, version string) error {
+	if len(version) == 0 {
+		return fmt.Errorf("a version is required for a conditional delete")
+	}
+	condition, err := ifMatch(version)
+	if err != nil {
+		return err
+	}
+	request, err := retryablehttp.NewRequest(http.MethodDelete, c.url("/item/%s", key), nil)
 	if err != nil {
 		return err
 	}
 	request.Header.Set("Authorization", c.token)
 	request.Header.Set("User-Agent", UserAgent)
-	resp, reqErr := c.Do(request)
+	request.Header.Set("If-Match", condition)
+	resp, reqErr := c.do(request)
 	if reqErr != nil {
 		return reqErr
 	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusPreconditionFailed {
+		return &ConflictError{Key: key, Version: version}
+	}
 	if resp.StatusCode > 299 {
-		return fmt.Errorf("cannot link items, source server responded with: %s", resp.Status)
+		return statusError(resp, "cannot delete item")
 	}
 	return nil
 }
 
-func (c *Client) Unlink(fromKey, toKey string) error {
-	request, err := retryablehttp.NewRequest(http.MethodDelete, c.url("/link/%s/to/%s", fromKey, toKey), nil)
+// Audit the history of changes made to the item identified by key, most recent first
+// limit: the maximum number of events to return (0 = server default)
+// returns ErrUnsupported if the source server does not keep an audit log
+func (c *Client) Audit(itemKey string, limit int) ([]AuditEvent, error) {
+	path := c.url("/item/%s/audit", itemKey)
+	if limit > 0 {
+		path = fmt.Sprintf("%s?limit=%d", path, limit)
+	}
+	request, err := retryablehttp.NewRequest(http.MethodGet, path, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	request.Header.Set("Authorization", c.token)
 	request.Header.Set("User-Agent", UserAgent)
-	resp, reqErr := c.Do(request)
+	resp, reqErr := c.do(request)
 	if reqErr != nil {
-		return reqErr
+		return nil, reqErr
+	}
+	defer resp.Body.Close()
+	if unsupported(resp.StatusCode) {
+		return nil, ErrUnsupported
 	}
 	if resp.StatusCode > 299 {
-		return fmt.Errorf("cannot unlink items, source server responded with: %s", resp.Status)
+		return nil, statusError(resp, "cannot get item audit events")
 	}
-	return nil
+	body, readErr := c.readBody(resp)
+	if readErr != nil {
+		return nil, fmt.Errorf("cannot read response body: %w", readErr)
+	}
+	if len(body) == 0 {
+		return nil, nil
+	}
+	var events []AuditEvent
+	err = json.Unmarshal(body, &events)
+	if err != nil {
+		return nil, fmt.Errorf("cannot unmarshal response body: %s", err)
+	}
+	return events, nil
 }
 
-func (c *Client) Delete(key string) error {
-	request, err := retryablehttp.NewRequest(http.MethodDelete, c.url("/item/%s", key), nil)
+// Stats the overall statistics of the source server store
+// if the server does not provide statistics, only the item counts per type are computed client-side
+// using one call per type, and the returned stats are flagged as Partial
+func (c *Client) Stats() (*StoreStats, error) {
+	request, err := retryablehttp.NewRequest(http.MethodGet, c.url("/stats"), nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	request.Header.Set("Authorization", c.token)
 	request.Header.Set("User-Agent", UserAgent)
-	resp, reqErr := c.Do(request)
+	resp, reqErr := c.do(request)
 	if reqErr != nil {
-		return reqErr
+		return nil, reqErr
+	}
+	defer resp.Body.Close()
+	if unsupported(resp.StatusCode) {
+		return c.partialStats()
 	}
 	if resp.StatusCode > 299 {
-		return fmt.Errorf("cannot delete item, source server responded with: %s", resp.Status)
+		return nil, statusError(resp, "cannot get store statistics")
 	}
-	return nil
+	body, readErr := c.readBody(resp)
+	if readErr != nil {
+		return nil, fmt.Errorf("cannot read response body: %w", readErr)
+	}
+	stats := new(StoreStats)
+	err = json.Unmarshal(body, stats)
+	if err != nil {
+		return nil, fmt.Errorf("cannot unmarshal response body: %s", err)
+	}
+	return stats, nil
+}
+
+// partialStats computes the item counts per type client-side
+func (c *Client) partialStats() (*StoreStats, error) {
+	types, err := c.ListTypes()
+	if err != nil {
+		return nil, err
+	}
+	stats := &StoreStats{
+		ItemsPerType: make(map[string]int, len(types)),
+		Partial:      true,
+	}
+	for _, t := range types {
+		count, countErr := c.Count(t.Key)
+		if countErr != nil {
+			return nil, countErr
+		}
+		stats.ItemsPerType[t.Key] = count
+		stats.Items += count
+	}
+	return stats, nil
+}
+
+// do executes the request tracking the retry attempts made for it
+func (c *Client) do(request *retryablehttp.Request) (*http.Response, error) {
+	return c.call(request, c.doWithin)
+}
+
+// doOnce executes the request in a single attempt bypassing the retrying client, e.g. if its body cannot be resent
+func (c *Client) doOnce(request *http.Request) (*http.Response, error) {
+	return c.call(&retryablehttp.Request{Request: request}, func(request *retryablehttp.Request, state *retryState) (*http.Response, error) {
+		state.attempts++
+		return c.HTTPClient.Do(request.Request)
+	})
+}
+
+// call executes the request using send, applying the client options and reporting it to the hooks
+func (c *Client) call(request *retryablehttp.Request, send func(*retryablehttp.Request, *retryState) (*http.Response, error)) (*http.Response, error) {
+	if err := c.checkWritable(request.Request); err != nil {
+		return nil, err
+	}
+	// the headers set by the call take precedence over those in the context, which take precedence over the client ones
+	for _, headers := range []http.Header{requestHeaders(request.Context()), c.headers} {
+		for name, values := range headers {
+			if len(request.Header.Values(name)) == 0 {
+				request.Header[name] = values
+			}
+		}
+	}
+	c.overrideMethod(request.Request)
+	// the caller may track the attempts itself
+	state := retryStateFrom(request.Context())
+	if state == nil {
+		var ctx context.Context
+		ctx, state = withRetryState(request.Context(), c.opts.Clock)
+		request = request.WithContext(ctx)
+	}
+	resp, err := send(request, state)
+	c.measure(request, state, resp, err)
+	if err == nil {
+		if authErr := authError(request.Request, resp); authErr != nil {
+			resp.Body.Close()
+			return nil, authErr
+		}
+	}
+	return resp, err
+}
+
+// methodOverrideHeader the header carrying the actual method of requests sent as POST, see MethodOverride
+const methodOverrideHeader = "X-HTTP-Method-Override"
+
+// overrideMethod sends the request as POST with its actual method in the override header if the client is set to
+func (c *Client) overrideMethod(request *http.Request) {
+	if !c.opts.MethodOverride || request.Method == http.MethodGet || request.Method == http.MethodHead || request.Method == http.MethodPost {
+		return
+	}
+	request.Header.Set(methodOverrideHeader, request.Method)
+	request.Method = http.MethodPost
+}
+
+// requestMethod the actual method of the request, before it was overridden
+func requestMethod(request *http.Request) string {
+	if method := request.Header.Get(methodOverrideHeader); len(method) > 0 {
+		return method
+	}
+	return request.Method
+}
+
+// checkWritable returns a *ReadOnlyError if the client is read-only and the request would modify the store
+func (c *Client) checkWritable(request *http.Request) error {
+	if !c.opts.ReadOnly {
+		return nil
+	}
+	switch request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return nil
+	}
+	// reads the tags of several items, see GetTagsBatch
+	if request.Method == http.MethodPost && strings.HasSuffix(request.URL.Path, "/item/tag/batch") {
+		return nil
+	}
+	return &ReadOnlyError{Method: request.Method, Path: request.URL.Path}
+}
+
+// doWithin executes the request within the MaxElapsedTime ceiling of the retry policy, if one is set
+// returns a *RetriesExhaustedError if the call failed after retrying or ran out of time
+func (c *Client) doWithin(request *retryablehttp.Request, state *retryState) (*http.Response, error) {
+	ctx, cancel := request.Context(), context.CancelFunc(func() {})
+	if c.opts.RetryPolicy.MaxElapsedTime > 0 {
+		ctx, cancel = context.WithTimeout(ctx, c.opts.RetryPolicy.MaxElapsedTime)
+	}
+	resp, err := c.Do(request.WithContext(ctx))
+	if err != nil {
+		cancel()
+		if ctx.Err() == context.DeadlineExceeded || (ctx.Err() == nil && state.lastErr != nil) {
+			return nil, state.exhaustedError(request.Request, err)
+		}
+		return nil, err
+	}
+	// the context must stay alive until the response body has been read
+	resp.Body = &cancelReadCloser{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
 }
 
 func (c *Client) url(format string, args ...any) string {
@@ -520,6 +2381,27 @@ func (c *Client) url(format string, args ...any) string {
 	return v
 }
 
+// timestampKey generates a time based sequence used to replace key wildcards
+func timestampKey(clock Clock) string {
+	return clock.Now().UTC().Format("20060102150405.000")
+}
+
 func basicToken(user string, pwd string) string {
 	return fmt.Sprintf("Basic %s", base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%s:%s", user, pwd))))
 }
+
+// authToken the value of the Authorization header for the scheme, basic authentication if the scheme is empty
+func authToken(scheme, user, pwd string) string {
+	if len(scheme) == 0 || strings.EqualFold(scheme, "Basic") {
+		return basicToken(user, pwd)
+	}
+	return fmt.Sprintf("%s %s", scheme, pwd)
+}
+
+// typeHeader the name of the header carrying the item type
+func (c *Client) typeHeader() string {
+	if len(c.opts.TypeHeader) > 0 {
+		return c.opts.TypeHeader
+	}
+	return "Source-Type"
+}
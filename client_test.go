@@ -9,7 +9,20 @@
 package src
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -127,3 +140,2171 @@ func TestItemsByType(t *testing.T) {
 		fmt.Printf("%d\n", item.(*ClientOptions).Timeout)
 	}
 }
+
+// TestOnRetry checks the retry callback is invoked for every failed attempt against a flaky server
+func TestOnRetry(t *testing.T) {
+	var calls int32
+	// fails the first three requests then succeeds
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) <= 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	var retries []int
+	var stats CallStats
+	c := New(server.URL, "admin", "adm1n", &ClientOptions{
+		Timeout: 30 * time.Second,
+		RetryPolicy: RetryPolicy{
+			MinWait: time.Millisecond,
+			MaxWait: 5 * time.Millisecond,
+			Jitter:  0.5,
+		},
+		OnRetry: func(attempt int, resp *http.Response, err error) {
+			retries = append(retries, attempt)
+		},
+		OnCall: func(s CallStats) {
+			stats = s
+		},
+	})
+	if err := c.Delete("OPT_1"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(retries) != 3 {
+		t.Fatalf("expected 3 retries, got %d", len(retries))
+	}
+	for i, attempt := range retries {
+		if attempt != i+1 {
+			t.Fatalf("expected attempt %d, got %d", i+1, attempt)
+		}
+	}
+	if stats.Attempts != 4 {
+		t.Fatalf("expected the call to report 4 attempts, got %d", stats.Attempts)
+	}
+}
+
+// TestMaxElapsedTime checks a call against a failing server returns within the configured ceiling
+func TestMaxElapsedTime(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	c := New(server.URL, "admin", "adm1n", &ClientOptions{
+		Timeout: 30 * time.Second,
+		RetryPolicy: RetryPolicy{
+			MinWait:        20 * time.Millisecond,
+			MaxWait:        100 * time.Millisecond,
+			MaxElapsedTime: 300 * time.Millisecond,
+		},
+	})
+	start := time.Now()
+	_, err := c.LoadRaw("OPT_1")
+	elapsed := time.Since(start)
+	if err == nil {
+		t.Fatalf("expected an error from a failing server")
+	}
+	if elapsed > 500*time.Millisecond {
+		t.Fatalf("call took %s, longer than the configured ceiling", elapsed)
+	}
+	fmt.Println(err)
+}
+
+// TestDeleteIfMatch checks a conditional delete is rejected if the item is modified after it was loaded
+func TestDeleteIfMatch(t *testing.T) {
+	var version int32 = 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := fmt.Sprintf("\"%d\"", atomic.LoadInt32(&version))
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("ETag", current)
+			w.Write([]byte(`{"key":"OPT_1","type":"AAA","value":"e30="}`))
+		case http.MethodPut:
+			atomic.AddInt32(&version, 1)
+		case http.MethodDelete:
+			if r.Header.Get("If-Match") != current {
+				w.WriteHeader(http.StatusPreconditionFailed)
+			}
+		}
+	}))
+	defer server.Close()
+	c := New(server.URL, "admin", "adm1n", nil)
+	item, err := c.LoadRaw("OPT_1")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	// someone else modifies the item after it was loaded
+	err = c.Save("OPT_1", "AAA", ClientOptions{Timeout: 60 * time.Second})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = c.DeleteIfMatch("OPT_1", item.Version)
+	var conflict *ConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("expected a conflict error, got: %v", err)
+	}
+	// deleting with the current version succeeds
+	item, _ = c.LoadRaw("OPT_1")
+	if err = c.DeleteIfMatch("OPT_1", item.Version); err != nil {
+		t.Fatalf(err.Error())
+	}
+}
+
+// TestLargeIntegerPrecision checks integers beyond the float64 precision load back exactly
+func TestLargeIntegerPrecision(t *testing.T) {
+	item, _ := json.Marshal(I{
+		Key:   "ID_1",
+		Type:  "IDS",
+		Value: []byte(`{"id":9007199254740993}`),
+	})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(item)
+	}))
+	defer server.Close()
+	c := New(server.URL, "admin", "adm1n", nil)
+	value, err := c.Load("ID_1", new(map[string]any))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	id := (*value.(*map[string]any))["id"]
+	if fmt.Sprint(id) != "9007199254740993" {
+		t.Fatalf("expected id 9007199254740993, got %v", id)
+	}
+	typed, err := c.Load("ID_1", new(struct {
+		ID int64 `json:"id"`
+	}))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if typed.(*struct {
+		ID int64 `json:"id"`
+	}).ID != 9007199254740993 {
+		t.Fatalf("expected id 9007199254740993, got %v", typed)
+	}
+}
+
+// TestGzipResponse checks compressed response bodies are transparently inflated
+func TestGzipResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		defer gz.Close()
+		gz.Write([]byte(`[{"key":"OPT_1","type":"AAA","value":"eyJUaW1lb3V0Ijo2MDAwMDAwMDAwMH0="}]`))
+	}))
+	defer server.Close()
+	// asking for compression explicitly prevents the transport from inflating the body itself
+	c := New(server.URL, "admin", "adm1n", nil).WithOptions(WithHeader("Accept-Encoding", "gzip"))
+	items, err := c.LoadItemsByType(func() any {
+		return new(ClientOptions)
+	}, "AAA")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(items) != 1 || items[0].(*ClientOptions).Timeout != 60*time.Second {
+		t.Fatalf("unexpected items: %v", items)
+	}
+}
+
+// TestEmptyResponse checks successful responses without content are reported clearly
+func TestEmptyResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	c := New(server.URL, "admin", "adm1n", nil)
+	item, err := c.PopOldest("AAA", new(ClientOptions))
+	if err != nil || item != nil {
+		t.Fatalf("expected no item and no error, got: %v, %v", item, err)
+	}
+	_, err = c.LoadRaw("OPT_1")
+	var emptyErr *EmptyResponseError
+	if !errors.As(err, &emptyErr) {
+		t.Fatalf("expected an empty response error, got: %v", err)
+	}
+	items, err := c.LoadItemsByTypeRaw("AAA")
+	if err != nil || len(items) != 0 {
+		t.Fatalf("expected no items and no error, got: %v, %v", items, err)
+	}
+}
+
+// TestApplyDryRun checks the operations planned to converge to a desired state
+func TestApplyDryRun(t *testing.T) {
+	opts := ClientOptions{Timeout: 60 * time.Second}
+	value, _ := json.Marshal(opts)
+	items, _ := json.Marshal(IL{{Key: "OPT_1", Type: "AAA", Value: value}})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/item/type/AAA":
+			w.Write(items)
+		case "/item/OPT_1/tag":
+			w.Write([]byte(`[{"name":"status","value":"dev"}]`))
+		case "/item/OPT_1/children":
+			w.Write([]byte(`[]`))
+		default:
+			t.Fatalf("unexpected request in dry-run mode: %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	defer server.Close()
+	c := New(server.URL, "admin", "adm1n", nil)
+	report, err := c.Apply(DesiredState{
+		Items: []DesiredItem{
+			{Key: "OPT_1", Type: "AAA", Value: opts, Tags: map[string]string{"status": "prod"}, Links: []string{"OPT_2"}},
+			{Key: "OPT_2", Type: "AAA", Value: opts},
+		},
+	}, ApplyOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	expected := []string{"save OPT_2", "tag OPT_1 -> status", "link OPT_1 -> OPT_2"}
+	if len(report.Operations) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, report.Operations)
+	}
+	for i, op := range report.Operations {
+		if op.String() != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, report.Operations)
+		}
+	}
+}
+
+// TestLoadRawIfModifiedSince checks items are only returned if modified after the specified time
+func TestLoadRawIfModifiedSince(t *testing.T) {
+	updated := time.Date(2022, 6, 1, 10, 0, 0, 0, time.UTC)
+	item, _ := json.Marshal(I{Key: "OPT_1", Type: "AAA", Value: []byte(`{}`), Updated: updated})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+		if err == nil && !updated.After(since) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write(item)
+	}))
+	defer server.Close()
+	c := New(server.URL, "admin", "adm1n", nil)
+	i, modified, err := c.LoadRawIfModifiedSince("OPT_1", updated.Add(-time.Hour))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !modified || i == nil || i.Key != "OPT_1" {
+		t.Fatalf("expected the modified item, got: %v, %v", i, modified)
+	}
+	i, modified, err = c.LoadRawIfModifiedSince("OPT_1", i.Updated)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if modified || i != nil {
+		t.Fatalf("expected the item not to be modified, got: %v, %v", i, modified)
+	}
+}
+
+// TestSchemaCache checks concurrent schema lookups are collapsed into a single fetch
+func TestSchemaCache(t *testing.T) {
+	var fetches int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		time.Sleep(50 * time.Millisecond)
+		w.Write([]byte(`{"key":"AAA","schema":"e30=","proto":"e30="}`))
+	}))
+	defer server.Close()
+	c := New(server.URL, "admin", "adm1n", nil)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.schema("AAA"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if fetches != 1 {
+		t.Fatalf("expected a single fetch, got %d", fetches)
+	}
+	c.InvalidateSchema("AAA")
+	if _, err := c.schema("AAA"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if fetches != 2 {
+		t.Fatalf("expected the schema to be fetched again after invalidation, got %d fetches", fetches)
+	}
+}
+
+// TestUpdateTypeProto checks updating the prototype of a type leaves its schema unchanged
+func TestUpdateTypeProto(t *testing.T) {
+	var lock sync.Mutex
+	types := map[string]*TT{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		body, _ := io.ReadAll(r.Body)
+		switch {
+		case r.Method == http.MethodPut && r.URL.Path == "/type":
+			tt := new(TT)
+			json.Unmarshal(body, tt)
+			types[tt.Key] = tt
+		case r.Method == http.MethodPut && strings.HasSuffix(r.URL.Path, "/proto"):
+			tt, ok := types[strings.Split(r.URL.Path, "/")[2]]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			tt.Proto = body
+		case r.Method == http.MethodGet:
+			tt, ok := types[strings.TrimPrefix(r.URL.Path, "/type/")]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(tt)
+		}
+	}))
+	defer server.Close()
+	c := New(server.URL, "admin", "adm1n", nil)
+	if err := c.SetType("AAA", ClientOptions{Timeout: 35 * time.Second}); err != nil {
+		t.Fatalf(err.Error())
+	}
+	before, err := c.GetType("AAA")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err = c.UpdateTypeProto("AAA", ClientOptions{Timeout: 90 * time.Second}); err != nil {
+		t.Fatalf(err.Error())
+	}
+	after, err := c.GetType("AAA")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !bytes.Equal(before.Schema, after.Schema) {
+		t.Fatalf("expected the schema to be unchanged")
+	}
+	if bytes.Equal(before.Proto, after.Proto) {
+		t.Fatalf("expected the prototype to be updated")
+	}
+	if err = c.UpdateTypeProto("BBB", ClientOptions{}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected a not found error, got: %v", err)
+	}
+}
+
+// TestGetProto checks the prototype of a type round trips into its go type
+func TestGetProto(t *testing.T) {
+	proto, _ := json.Marshal(ClientOptions{InsecureSkipVerify: true, Timeout: 45 * time.Second})
+	tt, _ := json.Marshal(TT{Key: "AAA", Schema: []byte(`{}`), Proto: proto})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/type/AAA" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(tt)
+	}))
+	defer server.Close()
+	c := New(server.URL, "admin", "adm1n", nil)
+	opts := new(ClientOptions)
+	if err := c.GetProto("AAA", opts); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !opts.InsecureSkipVerify || opts.Timeout != 45*time.Second {
+		t.Fatalf("unexpected prototype: %+v", opts)
+	}
+	if err := c.GetProto("BBB", opts); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected a not found error, got: %v", err)
+	}
+}
+
+// TestSaveCoalesced checks rapid saves of the same key are coalesced into a single write of the latest value
+func TestSaveCoalesced(t *testing.T) {
+	var lock sync.Mutex
+	var saved []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		lock.Lock()
+		saved = append(saved, string(body))
+		lock.Unlock()
+	}))
+	defer server.Close()
+	c := New(server.URL, "admin", "adm1n", &ClientOptions{
+		Timeout:          30 * time.Second,
+		CoalesceInterval: time.Hour,
+	})
+	for i := 1; i <= 10; i++ {
+		if err := c.SaveCoalesced("OPT_1", "AAA", ClientOptions{Timeout: time.Duration(30+i) * time.Second}); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	if err := c.Close(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(saved) != 1 {
+		t.Fatalf("expected a single save, got %d", len(saved))
+	}
+	latest, _ := json.Marshal(ClientOptions{Timeout: 40 * time.Second})
+	if saved[0] != string(latest) {
+		t.Fatalf("expected the latest value to be saved, got %s", saved[0])
+	}
+}
+
+// TestSaveAsync checks asynchronous saves report their result and are drained by Close
+func TestSaveAsync(t *testing.T) {
+	var saves int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&saves, 1)
+	}))
+	defer server.Close()
+	c := New(server.URL, "admin", "adm1n", &ClientOptions{
+		Timeout:        30 * time.Second,
+		AsyncWorkers:   2,
+		AsyncQueueSize: 1,
+	})
+	var results []<-chan error
+	for i := 0; i < 20; i++ {
+		results = append(results, c.SaveAsync("ITEM_?", "AAA", ClientOptions{Timeout: 30 * time.Second}))
+	}
+	if err := c.Close(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if saves != 20 {
+		t.Fatalf("expected 20 saves, got %d", saves)
+	}
+	for _, result := range results {
+		if err := <-result; err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	if err := <-c.SaveAsync("ITEM_?", "AAA", ClientOptions{Timeout: 30 * time.Second}); err != ErrClosed {
+		t.Fatalf("expected the client to be closed, got: %v", err)
+	}
+}
+
+// TestDrain checks Drain respects the context deadline and rejects saves once called
+func TestDrain(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+	c := New(server.URL, "admin", "adm1n", &ClientOptions{Timeout: 30 * time.Second})
+	result := c.SaveAsync("ITEM_A", "AAA", ClientOptions{Timeout: 30 * time.Second})
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := c.Drain(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the drain to time out, got: %v", err)
+	}
+	if err := c.SaveCoalesced("ITEM_B", "AAA", ClientOptions{Timeout: 30 * time.Second}); err != ErrClosed {
+		t.Fatalf("expected the client to be closed, got: %v", err)
+	}
+	release <- struct{}{}
+	if err := <-result; err != nil {
+		t.Fatalf(err.Error())
+	}
+}
+
+// TestCloseDuringFlush checks Close waits for a background flush in progress and reports its errors
+func TestCloseDuringFlush(t *testing.T) {
+	flushing := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flushing <- struct{}{}
+		time.Sleep(200 * time.Millisecond)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+	c := New(server.URL, "admin", "adm1n", &ClientOptions{Timeout: 30 * time.Second, CoalesceInterval: 10 * time.Millisecond})
+	if err := c.SaveCoalesced("ITEM_A", "AAA", ClientOptions{Timeout: 30 * time.Second}); err != nil {
+		t.Fatalf(err.Error())
+	}
+	// closes once the timer has fired and the flush is saving the item
+	<-flushing
+	if err := c.Close(); err == nil || !strings.Contains(err.Error(), "ITEM_A") {
+		t.Fatalf("expected the error of the background flush, got: %v", err)
+	}
+}
+
+// BenchmarkConnectionPool compares concurrent calls using the net/http idle pool size with the client default
+// e.g. go test -run ^$ -bench ConnectionPool
+func BenchmarkConnectionPool(b *testing.B) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"key":"ITEM_A","type":"AAA","value":"e30="}`))
+	}))
+	defer server.Close()
+	for _, perHost := range []int{http.DefaultMaxIdleConnsPerHost, defaultMaxIdleConnsPerHost} {
+		b.Run(fmt.Sprintf("MaxIdleConnsPerHost=%d", perHost), func(b *testing.B) {
+			c := New(server.URL, "admin", "adm1n", &ClientOptions{
+				Timeout:             30 * time.Second,
+				MaxIdleConnsPerHost: perHost,
+			})
+			b.SetParallelism(defaultMaxIdleConnsPerHost / 2)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if _, err := c.LoadRaw("ITEM_A"); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		})
+	}
+}
+
+// TestDisableHTTP2 checks the protocol negotiated over TLS with and without HTTP/2 disabled
+func TestDisableHTTP2(t *testing.T) {
+	var proto atomic.Value
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proto.Store(r.Proto)
+		w.Write([]byte(`{"key":"ITEM_A","type":"AAA","value":"e30="}`))
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+	for _, disabled := range []bool{false, true} {
+		c := New(server.URL, "admin", "adm1n", &ClientOptions{
+			InsecureSkipVerify: true,
+			Timeout:            30 * time.Second,
+			DisableHTTP2:       disabled,
+		})
+		if _, err := c.LoadRaw("ITEM_A"); err != nil {
+			t.Fatalf(err.Error())
+		}
+		expected := "HTTP/2.0"
+		if disabled {
+			expected = "HTTP/1.1"
+		}
+		if proto.Load() != expected {
+			t.Fatalf("expected %s with DisableHTTP2=%t, got %s", expected, disabled, proto.Load())
+		}
+	}
+}
+
+// TestValidateAgainstType checks a sample is validated client-side reporting the offending fields
+func TestValidateAgainstType(t *testing.T) {
+	schema := `{"$ref":"#/$defs/Endpoint","$defs":{"Endpoint":{"type":"object","required":["host","port"],"additionalProperties":false,
+		"properties":{"host":{"type":"string","minLength":1},"port":{"type":"integer","minimum":1,"maximum":65535},
+		"tags":{"type":"array","items":{"type":"string"}}}}}}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(TT{Key: "ENDPOINT", Schema: []byte(schema), Proto: []byte("{}")})
+	}))
+	defer server.Close()
+	c := New(server.URL, "admin", "adm1n", nil)
+	if err := c.ValidateAgainstType("ENDPOINT", map[string]any{"host": "localhost", "port": 8080, "tags": []string{"a"}}); err != nil {
+		t.Fatalf(err.Error())
+	}
+	err := c.ValidateAgainstType("ENDPOINT", map[string]any{"host": "", "port": 1.5, "tags": []any{1}, "extra": true})
+	var validationErr *SchemaValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected a validation error, got: %v", err)
+	}
+	expected := []string{"/extra", "/host", "/port", "/tags/0"}
+	if len(validationErr.Errors) != len(expected) {
+		t.Fatalf("expected %d field errors, got: %v", len(expected), validationErr)
+	}
+	for i, path := range expected {
+		if validationErr.Errors[i].Path != path {
+			t.Fatalf("expected field error %d at '%s', got: %v", i, path, validationErr.Errors[i])
+		}
+	}
+}
+
+// TestParseTagQuery checks tag queries are parsed with AND binding tighter than OR
+func TestParseTagQuery(t *testing.T) {
+	valid := map[string]string{
+		"(env=prod OR env=staging) AND tier=db": "(env=prod OR env=staging) AND tier=db",
+		"env=prod or env=staging and tier=db":   "env=prod OR (env=staging AND tier=db)",
+		"((critical))":                          "critical",
+		"a=1 AND (b=2 OR (c AND d=))":           "a=1 AND (b=2 OR (c AND d=))",
+	}
+	for query, expected := range valid {
+		q, err := ParseTagQuery(query)
+		if err != nil {
+			t.Fatalf("cannot parse '%s': %s", query, err)
+		}
+		if q.String() != expected {
+			t.Fatalf("expected '%s' to serialize as '%s', got '%s'", query, expected, q.String())
+		}
+	}
+	q := And(Or(HasTagValue("env", "prod"), HasTagValue("env", "staging")), HasTagValue("tier", "db"))
+	if q.String() != "(env=prod OR env=staging) AND tier=db" {
+		t.Fatalf("unexpected serialization of built query: %s", q)
+	}
+	for _, query := range []string{"", "env=prod AND", "(env=prod", "env=prod)", "OR tier=db", "=prod", "a b"} {
+		if _, err := ParseTagQuery(query); err == nil {
+			t.Fatalf("expected '%s' to be rejected", query)
+		}
+	}
+}
+
+// TestMaxResponseBytes checks responses larger than the limit are rejected
+func TestMaxResponseBytes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"key":"ITEM_A","type":"AAA","value":"` + strings.Repeat("A", 2048) + `"}`))
+	}))
+	defer server.Close()
+	c := New(server.URL, "admin", "adm1n", &ClientOptions{Timeout: 30 * time.Second, MaxResponseBytes: 1024})
+	_, err := c.LoadRaw("ITEM_A")
+	var tooLarge *ResponseTooLargeError
+	if !errors.As(err, &tooLarge) {
+		t.Fatalf("expected the response to be too large, got: %v", err)
+	}
+	if tooLarge.Path != "/item/ITEM_A" || tooLarge.Limit != 1024 {
+		t.Fatalf("unexpected error: %v", tooLarge)
+	}
+	c = New(server.URL, "admin", "adm1n", &ClientOptions{Timeout: 30 * time.Second, MaxResponseBytes: 4096})
+	if _, err = c.LoadRaw("ITEM_A"); err != nil {
+		t.Fatalf(err.Error())
+	}
+}
+
+// TestWaitReady checks WaitReady polls the health of the server until it is ready
+func TestWaitReady(t *testing.T) {
+	var checks int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&checks, 1) < 4 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	c := New(server.URL, "admin", "adm1n", nil)
+	var statusErr *StatusError
+	if err := c.Health(); !errors.As(err, &statusErr) || err.Error() != "source server is not healthy: GET /health failed: 503 Service Unavailable" {
+		t.Fatalf("expected a *StatusError, got: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.WaitReady(ctx, 10*time.Millisecond); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if checks != 4 {
+		t.Fatalf("expected 4 health checks, got %d", checks)
+	}
+	server.Close()
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := c.WaitReady(ctx, 10*time.Millisecond); err == nil {
+		t.Fatalf("expected the server not to be ready")
+	}
+}
+
+// TestWithSort checks the sort options are passed to the source server and the items returned in order
+func TestWithSort(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2022, 1, d, 0, 0, 0, 0, time.UTC) }
+	items := IL{{Key: "B", Updated: day(3)}, {Key: "C", Updated: day(1)}, {Key: "A", Updated: day(2)}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sorted := append(IL{}, items...)
+		field, desc := r.URL.Query().Get("sort"), r.URL.Query().Get("order") == "desc"
+		sort.Slice(sorted, func(i, j int) bool {
+			less := sorted[i].Key < sorted[j].Key
+			if field == "updated" {
+				less = sorted[i].Updated.Before(sorted[j].Updated)
+			}
+			return less != desc
+		})
+		json.NewEncoder(w).Encode(sorted)
+	}))
+	defer server.Close()
+	c := New(server.URL, "admin", "adm1n", nil)
+	cases := []struct {
+		field    SortField
+		order    SortOrder
+		expected string
+	}{
+		{SortByKey, Ascending, "ABC"},
+		{SortByKey, Descending, "CBA"},
+		{SortByUpdated, Ascending, "CAB"},
+		{SortByUpdated, Descending, "BAC"},
+	}
+	for _, tc := range cases {
+		sorted := c.WithOptions(WithSort(tc.field, tc.order))
+		for _, load := range []func() (IL, error){
+			func() (IL, error) { return sorted.LoadItemsByTypeRaw("AAA") },
+			func() (IL, error) { return sorted.LoadChildrenRaw("ROOT") },
+		} {
+			result, err := load()
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			var keys string
+			for _, item := range result {
+				keys += item.Key
+			}
+			if keys != tc.expected {
+				t.Fatalf("expected %s sorted %s as %s, got %s", tc.field, tc.order, tc.expected, keys)
+			}
+		}
+	}
+}
+
+// TestRetryBudget checks calls fail fast once the retry budget shared by the client is used up
+func TestRetryBudget(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	c := New(server.URL, "admin", "adm1n", &ClientOptions{
+		Timeout: 30 * time.Second,
+		RetryPolicy: RetryPolicy{
+			MinWait:         time.Millisecond,
+			MaxWait:         time.Millisecond,
+			BudgetPerSecond: 0.001,
+			BudgetBurst:     3,
+		},
+	})
+	for i := 0; i < 3; i++ {
+		if _, err := c.LoadRaw("ITEM_A"); err == nil {
+			t.Fatalf("expected the load to fail")
+		}
+	}
+	// the first call spends the 3 retries of the budget, the others fail after their first attempt
+	if attempts != 6 {
+		t.Fatalf("expected 6 attempts, got %d", attempts)
+	}
+	// a fractional rate without a burst still allows a retry
+	attempts = 0
+	c = New(server.URL, "admin", "adm1n", &ClientOptions{
+		Timeout: 30 * time.Second,
+		RetryPolicy: RetryPolicy{
+			MinWait:         time.Millisecond,
+			MaxWait:         time.Millisecond,
+			BudgetPerSecond: 0.001,
+		},
+	})
+	if _, err := c.LoadRaw("ITEM_A"); err == nil {
+		t.Fatalf("expected the load to fail")
+	}
+	if attempts != 2 {
+		t.Fatalf("expected 2 attempts, got %d", attempts)
+	}
+}
+
+// TestDiffJSON checks nested changes are reported at their exact path
+func TestDiffJSON(t *testing.T) {
+	a := `{"name":"app","port":80,"tls":{"enabled":false},"hosts":["a","b"],"old":1}`
+	b := `{"name":"app","port":80.0,"tls":{"enabled":true,"cert":"x"},"hosts":["a"],"a/b":null}`
+	diff, err := DiffJSON([]byte(a), []byte(b))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	expected := "+ /a~1b: null\n- /hosts/1: \"b\"\n- /old: 1\n+ /tls/cert: \"x\"\n~ /tls/enabled: false -> true"
+	if diff.String() != expected {
+		t.Fatalf("unexpected diff:\n%s", diff)
+	}
+	if diff, _ = DiffJSON([]byte(a), []byte(a)); !diff.Empty() {
+		t.Fatalf("expected no changes, got:\n%s", diff)
+	}
+	// integers above 2^53 are not compared as float64
+	diff, _ = DiffJSON([]byte(`{"id":9007199254740993}`), []byte(`{"id":9007199254740992}`))
+	if diff.String() != "~ /id: 9007199254740993 -> 9007199254740992" {
+		t.Fatalf("unexpected diff:\n%s", diff)
+	}
+}
+
+// TestSaveVerifiedRounded checks a value rounded by the server through float64 fails the verification
+func TestSaveVerifiedRounded(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			_ = json.NewEncoder(w).Encode(I{Key: "ITEM_A", Type: "T_1", Value: []byte(`{"id":9007199254740992}`)})
+		}
+	}))
+	defer server.Close()
+	c := New(server.URL, "admin", "adm1n", &ClientOptions{Timeout: 30 * time.Second})
+	var verifyErr *VerificationError
+	if err := c.SaveVerified("ITEM_A", "T_1", idValue{ID: 9007199254740993}); !errors.As(err, &verifyErr) || len(verifyErr.Changes) != 1 {
+		t.Fatalf("expected a *VerificationError, got: %v", err)
+	}
+}
+
+// idValue an item value holding a 64-bit id
+type idValue struct {
+	ID int64 `json:"id"`
+}
+
+func (v idValue) Validate() error {
+	return nil
+}
+
+// TestMergeValues checks objects are deep-merged and conflicts resolved as per the strategy
+func TestMergeValues(t *testing.T) {
+	var base, overlay any
+	json.Unmarshal([]byte(`{"name":"app","db":{"host":"localhost","port":5432},"hosts":["a","b"]}`), &base)
+	json.Unmarshal([]byte(`{"db":{"host":"prod-db"},"hosts":["b","c"],"debug":false}`), &overlay)
+	cases := []struct {
+		strategy  MergeStrategy
+		expected  string
+		conflicts int
+	}{
+		{MergeStrategy{}, `{"db":{"host":"prod-db","port":5432},"debug":false,"hosts":["b","c"],"name":"app"}`, 0},
+		{MergeStrategy{Arrays: ArrayUnion, Conflicts: BaseWins}, `{"db":{"host":"localhost","port":5432},"debug":false,"hosts":["a","b","c"],"name":"app"}`, 0},
+		{MergeStrategy{Arrays: ArrayAppend, Conflicts: FailOnConflict}, `{"db":{"host":"prod-db","port":5432},"debug":false,"hosts":["a","b","b","c"],"name":"app"}`, 1},
+	}
+	for i, tc := range cases {
+		var conflicts []string
+		merged, _ := json.Marshal(mergeValues("", base, overlay, tc.strategy, &conflicts))
+		if string(merged) != tc.expected || len(conflicts) != tc.conflicts {
+			t.Fatalf("case %d: unexpected merge %s with conflicts %v", i, merged, conflicts)
+		}
+	}
+}
+
+// TestAuthError checks 401 and 403 responses are reported as an AuthError without retrying
+func TestAuthError(t *testing.T) {
+	var attempts int32
+	status := http.StatusUnauthorized
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	c := New(server.URL, "admin", "wrong", nil)
+	if _, err := c.LoadRaw("ITEM_A"); !errors.Is(err, ErrUnauthorized) || errors.Is(err, ErrForbidden) {
+		t.Fatalf("expected an unauthorized error, got: %v", err)
+	} else if err.Error() != "GET /item/ITEM_A failed: 401 Unauthorized" {
+		t.Fatalf("unexpected message: %s", err)
+	}
+	status = http.StatusForbidden
+	if err := c.Delete("ITEM_A"); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("expected a forbidden error, got: %v", err)
+	}
+	if attempts != 2 {
+		t.Fatalf("expected a single attempt per call, got %d attempts", attempts)
+	}
+}
+
+// TestDisableRetry checks a single attempt is made when retries are disabled
+func TestDisableRetry(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	start := time.Now()
+	c := New(server.URL, "admin", "adm1n", &ClientOptions{Timeout: 30 * time.Second, DisableRetry: true})
+	if _, err := c.LoadRaw("ITEM_A"); err == nil {
+		t.Fatalf("expected the load to fail")
+	}
+	if attempts != 1 {
+		t.Fatalf("expected a single attempt, got %d", attempts)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected the call to fail fast without backing off, it took %s", elapsed)
+	}
+}
+
+// TestWithRequestHeaders checks the headers in the context are sent by the context-aware methods
+func TestWithRequestHeaders(t *testing.T) {
+	var tenant, correlation atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant.Store(r.Header.Get("X-Tenant"))
+		correlation.Store(r.Header.Get("X-Correlation-Id"))
+		w.Write([]byte("[]"))
+	}))
+	defer server.Close()
+	c := New(server.URL, "admin", "adm1n", nil).WithOptions(WithHeader("X-Tenant", "default"), WithHeader("X-Correlation-Id", "none"))
+	ctx := WithRequestHeaders(context.Background(), http.Header{"x-correlation-id": []string{"abc"}})
+	if _, err := c.LoadAllByTypeContext(ctx, "AAA"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if tenant.Load() != "default" || correlation.Load() != "abc" {
+		t.Fatalf("unexpected headers: tenant=%v, correlation=%v", tenant.Load(), correlation.Load())
+	}
+}
+
+// TestTypeHeaderAndAuthScheme checks the configured type header name and authorization scheme are sent
+func TestTypeHeaderAndAuthScheme(t *testing.T) {
+	var itemType, auth atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		itemType.Store(r.Header.Get("X-Item-Type"))
+		auth.Store(r.Header.Get("Authorization"))
+	}))
+	defer server.Close()
+	c := New(server.URL, "", "t0k3n", &ClientOptions{Timeout: 30 * time.Second, TypeHeader: "X-Item-Type", AuthScheme: "Bearer"})
+	if err := c.Save("ITEM_A", "AAA", ClientOptions{Timeout: 30 * time.Second}); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if itemType.Load() != "AAA" || auth.Load() != "Bearer t0k3n" {
+		t.Fatalf("unexpected headers: type=%v, authorization=%v", itemType.Load(), auth.Load())
+	}
+}
+
+// TestExportImportTar checks a store exported as a tar archive is restored as it was
+func TestExportImportTar(t *testing.T) {
+	var lock sync.Mutex
+	items := map[string]I{"ITEM_A": {Key: "ITEM_A", Type: "AAA", Value: []byte(`{"a":1}`)}}
+	var tags, links []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/type":
+			json.NewEncoder(w).Encode([]TT{{Key: "AAA", Schema: []byte("{}"), Proto: []byte("{}")}})
+		case r.Method == http.MethodGet && r.URL.Path == "/item/type/AAA":
+			var page IL
+			if r.URL.Query().Get("offset") == "0" {
+				for _, item := range items {
+					page = append(page, item)
+				}
+			}
+			json.NewEncoder(w).Encode(page)
+		case r.URL.Path == "/item/tag/batch":
+			json.NewEncoder(w).Encode(map[string][]T{"ITEM_A": {{Name: "env", Value: "prod"}}})
+		case r.Method == http.MethodGet && r.URL.Path == "/link":
+			json.NewEncoder(w).Encode([]L{{From: "ITEM_A", To: "ITEM_A"}})
+		case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/item/ITEM_A/tag/"):
+			tags = append(tags, strings.TrimPrefix(r.URL.Path, "/item/ITEM_A/tag/"))
+		case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/link/"):
+			links = append(links, r.URL.Path)
+		case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/item/"):
+			value, _ := io.ReadAll(r.Body)
+			key := strings.TrimPrefix(r.URL.Path, "/item/")
+			items[key] = I{Key: key, Type: r.Header.Get("Source-Type"), Value: value}
+		}
+	}))
+	defer server.Close()
+	c := New(server.URL, "admin", "adm1n", nil)
+	var archive bytes.Buffer
+	if err := c.ExportTar(&archive, ExportOptions{}); err != nil {
+		t.Fatalf(err.Error())
+	}
+	delete(items, "ITEM_A")
+	if err := c.ImportTar(&archive, ImportOptions{}); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if item := items["ITEM_A"]; item.Type != "AAA" || string(item.Value) != `{"a":1}` {
+		t.Fatalf("unexpected item restored: %+v", item)
+	}
+	if len(tags) != 1 || tags[0] != "env|prod" || len(links) != 1 {
+		t.Fatalf("unexpected tags %v or links %v restored", tags, links)
+	}
+}
+
+// TestLoadRange checks a range of the value is returned whether or not the server honours the Range header
+func TestLoadRange(t *testing.T) {
+	value := []byte("0123456789")
+	for _, honoursRange := range []bool{true, false} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if honoursRange {
+				http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(value))
+				return
+			}
+			w.Write(value)
+		}))
+		c := New(server.URL, "admin", "adm1n", nil)
+		var buf bytes.Buffer
+		total, err := c.LoadRange("ITEM_A", 2, 4, &buf)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if buf.String() != "234" || total != 10 {
+			t.Fatalf("unexpected range %q of %d bytes when honouring range is %t", buf.String(), total, honoursRange)
+		}
+		// a range past the end of the value fails whether the server honours it or not
+		if _, err = c.LoadRange("ITEM_A", 10, 30, &buf); err == nil || !strings.Contains(err.Error(), "outside the value") {
+			t.Fatalf("expected the range to be outside the value when honouring range is %t, got: %v", honoursRange, err)
+		}
+		server.Close()
+	}
+}
+
+// TestCanonicalJSONCodec checks equal values always marshal to the same bytes
+func TestCanonicalJSONCodec(t *testing.T) {
+	type value struct {
+		Name  string          `json:"name"`
+		Extra json.RawMessage `json:"extra"`
+		Map   map[string]int  `json:"map"`
+	}
+	codec := CanonicalJSONCodec{}
+	expected := `{"extra":{"a":[1,2.50],"b":"<x>"},"map":{"a":1,"b":2,"c":3},"name":"app"}`
+	for _, extra := range []string{`{"b":"<x>","a":[1,2.50]}`, `{ "a" : [1, 2.50], "b" : "<x>" }`} {
+		for i := 0; i < 10; i++ {
+			data, err := codec.Marshal(value{Name: "app", Extra: json.RawMessage(extra), Map: map[string]int{"c": 3, "a": 1, "b": 2}})
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			if string(data) != expected {
+				t.Fatalf("expected %s, got %s", expected, data)
+			}
+		}
+	}
+}
+
+// TestLoadAllByTypeCursor checks paging follows the cursors and falls back to offsets if the server does not return any
+func TestLoadAllByTypeCursor(t *testing.T) {
+	for _, cursors := range []bool{true, false} {
+		var pages int
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			pages++
+			start := 0
+			if cursors {
+				start, _ = strconv.Atoi(r.URL.Query().Get("cursor"))
+			} else {
+				start, _ = strconv.Atoi(r.URL.Query().Get("offset"))
+			}
+			var items IL
+			for i := start; i < start+PageSize && i < PageSize+5; i++ {
+				items = append(items, I{Key: fmt.Sprintf("ITEM_%d", i), Type: "T_A"})
+			}
+			if cursors {
+				next := ""
+				if start == 0 {
+					next = strconv.Itoa(PageSize)
+				}
+				w.Header().Set(nextCursorHeader, next)
+			}
+			json.NewEncoder(w).Encode(items)
+		}))
+		c := New(server.URL, "admin", "adm1n", nil)
+		all, err := c.LoadAllByType("T_A")
+		server.Close()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if len(all) != PageSize+5 || pages != 2 {
+			t.Fatalf("expected %d items in 2 pages, got %d items in %d pages when paging by cursor is %t", PageSize+5, len(all), pages, cursors)
+		}
+	}
+}
+
+// TestKeyRulesChars checks the key rules can only allow characters sent unescaped in a url path
+func TestKeyRulesChars(t *testing.T) {
+	opts := ClientOptions{Timeout: 5 * time.Second, KeyRules: &KeyRules{AllowedChars: "-_"}}
+	if err := opts.Validate(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	for _, chars := range []string{"-/", "#", "%"} {
+		opts.KeyRules.AllowedChars = chars
+		if err := opts.Validate(); err == nil {
+			t.Fatalf("expected allowing %q to be rejected", chars)
+		}
+		if err := opts.KeyRules.Validate("ITEM_A"); err == nil {
+			t.Fatalf("expected keys to be rejected by rules allowing %q", chars)
+		}
+	}
+}
+
+// TestTimeoutFloor checks a client can fail fast using a timeout of a few seconds but not a zero timeout
+func TestTimeoutFloor(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	opts := &ClientOptions{Timeout: 5 * time.Second}
+	if err := opts.Validate(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	c := New(server.URL, "admin", "adm1n", opts)
+	if err := c.Save("OPT_1", "AAA", ClientOptions{Timeout: 5 * time.Second}); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := c.Save("OPT_2", "AAA", ClientOptions{}); err == nil {
+		t.Fatalf("expected a zero timeout to be rejected")
+	}
+}
+
+// TestIncrement checks an increment starts over when the item is modified concurrently
+func TestIncrement(t *testing.T) {
+	var (
+		puts  int
+		saved []byte
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			json.NewEncoder(w).Encode(I{Key: "COUNTER", Type: "T_A", Value: []byte(`{"usage":{"calls":41},"name":"x"}`), Version: "v1"})
+			return
+		}
+		if puts++; puts == 1 || r.Header.Get("If-Match") != "v1" {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		saved, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+	c := New(server.URL, "admin", "adm1n", nil)
+	n, err := c.Increment("COUNTER", "/usage/calls", 1)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if n != 42 || puts != 2 || string(saved) != `{"name":"x","usage":{"calls":42}}` {
+		t.Fatalf("unexpected increment to %d after %d saves: %s", n, puts, saved)
+	}
+	if _, err = c.Increment("COUNTER", "/name", 1); err == nil {
+		t.Fatalf("expected incrementing a string to fail")
+	}
+}
+
+// TestIncrementRetried checks an increment saved by an attempt whose response was lost is not applied twice
+func TestIncrementRetried(t *testing.T) {
+	var (
+		lock    sync.Mutex
+		puts    int
+		version = 1
+		value   = `{"calls":41}`
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		if r.Method == http.MethodGet {
+			json.NewEncoder(w).Encode(I{Key: "COUNTER", Type: "T_A", Value: []byte(value), Version: strconv.Itoa(version)})
+			return
+		}
+		puts++
+		if r.Header.Get("If-Match") != strconv.Itoa(version) {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		value = string(body)
+		version++
+		// the save is applied but its response is lost
+		if puts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	c := New(server.URL, "admin", "adm1n", &ClientOptions{
+		Timeout:     30 * time.Second,
+		RetryPolicy: RetryPolicy{MinWait: time.Millisecond, MaxWait: time.Millisecond},
+	})
+	n, err := c.Increment("COUNTER", "/calls", 1)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if n != 42 || puts != 2 || value != `{"calls":42}` {
+		t.Fatalf("unexpected increment to %d after %d saves: %s", n, puts, value)
+	}
+}
+
+// TestUntagMany checks several tags are removed at once and absent tags count as removed
+func TestUntagMany(t *testing.T) {
+	var lock sync.Mutex
+	tags := map[string]string{"env": "prod", "team": "core", "tier": "1"}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		switch r.Method {
+		case http.MethodGet:
+			var result []T
+			for name, value := range tags {
+				result = append(result, T{Name: name, Value: value})
+			}
+			json.NewEncoder(w).Encode(result)
+		case http.MethodDelete:
+			delete(tags, strings.TrimPrefix(r.URL.Path, "/item/ITEM_A/tag/"))
+		}
+	}))
+	defer server.Close()
+	c := New(server.URL, "admin", "adm1n", nil)
+	failures, err := c.UntagMany("ITEM_A", "env", "team", "missing")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(failures) > 0 || len(tags) != 1 || tags["tier"] != "1" {
+		t.Fatalf("expected only the tier tag to remain, got %v with failures %v", tags, failures)
+	}
+	if err = c.UntagAll("ITEM_A"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(tags) != 0 {
+		t.Fatalf("expected no tags to remain, got %v", tags)
+	}
+}
+
+// TestRedirects checks redirects can be refused and credentials kept from other hosts when following them
+func TestRedirects(t *testing.T) {
+	var auth []string
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = append(auth, r.Header.Get("Authorization"))
+		json.NewEncoder(w).Encode(I{Key: "ITEM_A", Type: "T_A", Value: []byte("{}")})
+	}))
+	defer target.Close()
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL+r.URL.Path, http.StatusTemporaryRedirect)
+	}))
+	defer origin.Close()
+	// the target has the same host but another port
+	for _, sameHost := range []bool{false, true} {
+		auth = nil
+		c := New(origin.URL, "admin", "adm1n", &ClientOptions{Timeout: 30 * time.Second, RedirectAuthSameHost: sameHost})
+		if _, err := c.LoadRaw("ITEM_A"); err != nil {
+			t.Fatalf(err.Error())
+		}
+		if len(auth) != 1 || (len(auth[0]) == 0) != sameHost {
+			t.Fatalf("unexpected credentials %q sent to the redirect target when same host only is %t", auth, sameHost)
+		}
+	}
+	auth = nil
+	c := New(origin.URL, "admin", "adm1n", &ClientOptions{Timeout: 30 * time.Second, DisableRedirects: true})
+	if _, err := c.LoadRaw("ITEM_A"); err == nil || len(auth) > 0 {
+		t.Fatalf("expected the redirect not to be followed")
+	}
+}
+
+// TestSetTypes checks several types are registered at once, falling back to one request per type
+func TestSetTypes(t *testing.T) {
+	type service struct {
+		Name  string   `json:"name"`
+		Ports []int    `json:"ports"`
+		Tags  []string `json:"tags,omitempty"`
+	}
+	var (
+		lock       sync.Mutex
+		registered []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/types" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		var typeInfo TT
+		json.NewDecoder(r.Body).Decode(&typeInfo)
+		lock.Lock()
+		registered = append(registered, typeInfo.Key)
+		lock.Unlock()
+	}))
+	defer server.Close()
+	c := New(server.URL, "admin", "adm1n", nil)
+	failures, err := c.SetTypes(map[string]any{
+		"T_OPTIONS": ClientOptions{Timeout: 30 * time.Second},
+		"T_SERVICE": service{Name: "api", Ports: []int{80}},
+		"T_EMPTY":   struct{}{},
+	})
+	if err != nil || failures != nil {
+		t.Fatalf("unexpected failures %v: %v", failures, err)
+	}
+	sort.Strings(registered)
+	if strings.Join(registered, ",") != "T_EMPTY,T_OPTIONS,T_SERVICE" {
+		t.Fatalf("unexpected types registered: %v", registered)
+	}
+	registered = nil
+	failures, err = c.SetTypes(map[string]any{"T_SERVICE": service{}, "": struct{}{}})
+	if err == nil || failures[""] == nil || len(registered) > 0 {
+		t.Fatalf("expected no type to be registered if one is invalid")
+	}
+	// a 404 might come from a proxy, it does not prove the server lacks bulk registration
+	missing := httptest.NewServer(http.NotFoundHandler())
+	defer missing.Close()
+	c = New(missing.URL, "admin", "adm1n", &ClientOptions{Timeout: 30 * time.Second, DisableRetry: true})
+	if _, err = c.SetTypes(map[string]any{"T_SERVICE": service{}}); err == nil {
+		t.Fatalf("expected the bulk registration to fail")
+	}
+}
+
+// TestOnBody checks the body hook receives the bodies sent and received while the caller still reads the response
+func TestOnBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		json.NewEncoder(w).Encode(I{Key: "ITEM_A", Type: "AAA", Value: []byte("{}")})
+	}))
+	defer server.Close()
+	var ops []string
+	c := New(server.URL, "admin", "adm1n", &ClientOptions{
+		Timeout: 30 * time.Second,
+		OnBody: func(op string, reqBody, respBody []byte, status int) {
+			ops = append(ops, fmt.Sprintf("%s %d %s %s", op, status, reqBody, bytes.TrimSpace(respBody)))
+		},
+	})
+	if err := c.Save("ITEM_A", "AAA", ClientOptions{Timeout: 30 * time.Second}); err != nil {
+		t.Fatalf(err.Error())
+	}
+	item, err := c.LoadRaw("ITEM_A")
+	if err != nil || item.Key != "ITEM_A" {
+		t.Fatalf("cannot load item after recording its body: %v", err)
+	}
+	if len(ops) != 2 || !strings.HasPrefix(ops[0], `PUT /item/ITEM_A 201 {"InsecureSkipVerify":false`) ||
+		!strings.HasPrefix(ops[1], `GET /item/ITEM_A 200  {"key":"ITEM_A","type":"AAA","value":"e30="`) {
+		t.Fatalf("unexpected bodies recorded: %q", ops)
+	}
+}
+
+// TestPopTieBreak checks items updated at the same time are popped and listed in a stable key order
+func TestPopTieBreak(t *testing.T) {
+	var lock sync.Mutex
+	updated := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := map[string]I{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		switch {
+		case r.Method == http.MethodPut:
+			key := strings.TrimPrefix(r.URL.Path, "/item/")
+			value, _ := io.ReadAll(r.Body)
+			store[key] = I{Key: key, Type: r.Header.Get("Source-Type"), Value: value, Updated: updated}
+		case strings.HasPrefix(r.URL.Path, "/item/pop/"):
+			if r.URL.Query().Get("tiebreak") != TieBreakByKey || len(store) == 0 {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			var keys []string
+			for key := range store {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			key := keys[0]
+			if strings.HasPrefix(r.URL.Path, "/item/pop/newest/") {
+				key = keys[len(keys)-1]
+			}
+			json.NewEncoder(w).Encode(store[key])
+			delete(store, key)
+		default:
+			// lists the items in map order, leaving the client to break the ties
+			var items IL
+			for _, item := range store {
+				items = append(items, item)
+			}
+			json.NewEncoder(w).Encode(items)
+		}
+	}))
+	defer server.Close()
+	c := New(server.URL, "admin", "adm1n", nil)
+	for _, key := range []string{"JOB_C", "JOB_A", "JOB_D", "JOB_B"} {
+		if err := c.Save(key, "AAA", ClientOptions{Timeout: 30 * time.Second}); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	items, err := c.WithOptions(WithSort(SortByUpdated, Descending)).LoadItemsByTypeRaw("AAA")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	var listed []string
+	for _, item := range items {
+		listed = append(listed, item.Key)
+	}
+	if strings.Join(listed, ",") != "JOB_D,JOB_C,JOB_B,JOB_A" {
+		t.Fatalf("unexpected list order: %v", listed)
+	}
+	var popped []string
+	for _, pop := range []func(string) (*I, error){c.PopOldestRaw, c.PopNewestRaw, c.PopOldestRaw, c.PopOldestRaw} {
+		item, popErr := pop("AAA")
+		if popErr != nil || item == nil {
+			t.Fatalf("cannot pop item: %v", popErr)
+		}
+		popped = append(popped, item.Key)
+	}
+	if strings.Join(popped, ",") != "JOB_A,JOB_D,JOB_B,JOB_C" {
+		t.Fatalf("unexpected pop order: %v", popped)
+	}
+}
+
+// TestETag checks weak and strong entity tags are parsed and compared as per RFC 7232
+func TestETag(t *testing.T) {
+	cases := []struct {
+		a, b         string
+		strong, weak bool
+	}{
+		{`"v1"`, `"v1"`, true, true},
+		{`W/"v1"`, `"v1"`, false, true},
+		{`W/"v1"`, `W/"v1"`, false, true},
+		{`"v1"`, `"v2"`, false, false},
+		{`W/"v1"`, `W/"v2"`, false, false},
+		{`v1`, `"v1"`, true, true},
+	}
+	for _, tc := range cases {
+		a, err := ParseETag(tc.a)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		b, err := ParseETag(tc.b)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if a.StrongMatch(b) != tc.strong || a.WeakMatch(b) != tc.weak {
+			t.Fatalf("unexpected comparison of %s and %s", tc.a, tc.b)
+		}
+	}
+	for _, invalid := range []string{`W/v1`, `"v1`, `""`, `"v 1"`} {
+		if _, err := ParseETag(invalid); err == nil {
+			t.Fatalf("expected %s to be invalid", invalid)
+		}
+	}
+	if etag, _ := ParseETag(`W/"v1"`); etag.String() != `W/"v1"` {
+		t.Fatalf("unexpected weak tag %s", etag)
+	}
+	c := New("http://127.0.0.1:1", "admin", "adm1n", nil)
+	if err := c.DeleteIfMatch("ITEM_A", `W/"v1"`); err == nil {
+		t.Fatalf("expected a weak tag to be refused for a conditional delete")
+	}
+}
+
+// TestSaveIfNotExists checks a create-only save replayed after its response was lost succeeds rather than conflicting
+func TestSaveIfNotExists(t *testing.T) {
+	var (
+		lock   sync.Mutex
+		stored = map[string]I{}
+		puts   int
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		key := strings.TrimPrefix(r.URL.Path, "/item/")
+		if r.Method == http.MethodGet {
+			json.NewEncoder(w).Encode(stored[key])
+			return
+		}
+		if _, exists := stored[key]; exists && r.Header.Get("If-None-Match") == "*" {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		value, _ := io.ReadAll(r.Body)
+		stored[key] = I{Key: key, Type: r.Header.Get("Source-Type"), Value: value}
+		// the first create succeeds but its response is lost
+		if puts++; puts == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+	c := New(server.URL, "admin", "adm1n", &ClientOptions{
+		Timeout:     30 * time.Second,
+		RetryPolicy: RetryPolicy{MinWait: time.Millisecond, MaxWait: time.Millisecond},
+	})
+	if err := c.SaveIfNotExists("ITEM_A", "AAA", ClientOptions{Timeout: 30 * time.Second}); err != nil {
+		t.Fatalf("expected the replayed create to succeed, got: %v", err)
+	}
+	err := c.SaveIfNotExists("ITEM_A", "AAA", ClientOptions{Timeout: 40 * time.Second})
+	var exists *AlreadyExistsError
+	if !errors.As(err, &exists) || exists.Key != "ITEM_A" {
+		t.Fatalf("expected an *AlreadyExistsError, got: %v", err)
+	}
+}
+
+// TestRetry checks operations are retried on transient errors only
+func TestRetry(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	c := New(server.URL, "admin", "adm1n", &ClientOptions{Timeout: 30 * time.Second, DisableRetry: true})
+	_, unavailable := c.LoadRaw("ITEM_A")
+	if !IsTransient(unavailable) || IsTransient(ErrNotFound) || IsTransient(&AuthError{StatusCode: http.StatusUnauthorized}) {
+		t.Fatalf("unexpected classification of %v", unavailable)
+	}
+	var exhausted *RetriesExhaustedError
+	var statusErr *StatusError
+	if !errors.As(unavailable, &exhausted) || !errors.As(unavailable, &statusErr) || statusErr.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected the last status to be wrapped, got %v", unavailable)
+	}
+	policy := RetryPolicy{MinWait: time.Millisecond, MaxWait: time.Millisecond}
+	var calls int
+	err := Retry(context.Background(), policy, func() error {
+		if calls++; calls < 3 {
+			return unavailable
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Fatalf("expected success on the third call, got %v after %d calls", err, calls)
+	}
+	calls = 0
+	err = Retry(context.Background(), policy, func() error {
+		calls++
+		return ErrNotFound
+	})
+	if !errors.Is(err, ErrNotFound) || calls != 1 {
+		t.Fatalf("expected a single call, got %d", calls)
+	}
+	// the context error is matched while the last error is still wrapped
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err = Retry(ctx, RetryPolicy{MinWait: time.Hour, MaxWait: time.Hour}, func() error { return unavailable })
+	if !errors.Is(err, context.DeadlineExceeded) || !errors.As(err, &statusErr) {
+		t.Fatalf("expected the deadline and the last error to be matched, got %v", err)
+	}
+}
+
+// TestReadOnly checks every method modifying the store refuses without sending a request while reads still work
+func TestReadOnly(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			t.Errorf("unexpected %s %s sent by a read-only client", r.Method, r.URL.Path)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/tag") {
+			json.NewEncoder(w).Encode([]T{{Name: "env", Value: "dev"}})
+			return
+		}
+		json.NewEncoder(w).Encode(I{Key: "ITEM_A", Type: "AAA", Value: []byte(`{"n":1}`), Version: "v1"})
+	}))
+	defer server.Close()
+	c := New(server.URL, "admin", "adm1n", &ClientOptions{Timeout: 30 * time.Second, ReadOnly: true})
+	opts := ClientOptions{Timeout: 30 * time.Second}
+	writes := map[string]func() error{
+		"Save":            func() error { return c.Save("ITEM_A", "AAA", opts) },
+		"SaveWithMeta":    func() error { return c.SaveWithMeta("ITEM_A", "AAA", opts, SaveMeta{}) },
+		"SaveIfChanged":   func() error { _, err := c.SaveIfChanged("ITEM_A", "AAA", opts); return err },
+		"SaveIfNotExists": func() error { return c.SaveIfNotExists("ITEM_A", "AAA", opts) },
+		"SaveVerified":    func() error { return c.SaveVerified("ITEM_A", "AAA", opts) },
+		"SaveStream":      func() error { return c.SaveStream("ITEM_A", "AAA", strings.NewReader("{}")) },
+		"Increment":       func() error { _, err := c.Increment("ITEM_A", "/n", 1); return err },
+		"Delete":          func() error { return c.Delete("ITEM_A") },
+		"DeleteIfMatch":   func() error { return c.DeleteIfMatch("ITEM_A", "v1") },
+		"Tag":             func() error { return c.Tag("ITEM_A", "env", "prod") },
+		"TagIfChanged":    func() error { _, err := c.TagIfChanged("ITEM_A", "env", "prod"); return err },
+		"Untag":           func() error { return c.Untag("ITEM_A", "env") },
+		"UntagMany":       func() error { failures, _ := c.UntagMany("ITEM_A", "env"); return failures["env"] },
+		"UntagAll":        func() error { return c.UntagAll("ITEM_A") },
+		"Link":            func() error { return c.Link("ITEM_A", "ITEM_B") },
+		"Unlink":          func() error { return c.Unlink("ITEM_A", "ITEM_B") },
+		"PopOldestRaw":    func() error { _, err := c.PopOldestRaw("AAA"); return err },
+		"PopNewestRaw":    func() error { _, err := c.PopNewestRaw("AAA"); return err },
+		"SetType":         func() error { return c.SetType("AAA", opts) },
+		"SetTypes":        func() error { _, err := c.SetTypes(map[string]any{"AAA": opts}); return err },
+		"UpdateTypeProto": func() error { return c.UpdateTypeProto("AAA", opts) },
+		"SetAnnotations":  func() error { return c.SetAnnotations("ITEM_A", map[string]string{"a": "b"}) },
+		"Reindex":         func() error { return c.Reindex(ReindexOptions{}) },
+		"Tx":              func() error { return c.Tx(func(tx *Transaction) error { tx.Delete("ITEM_A"); return nil }) },
+	}
+	for name, write := range writes {
+		var readOnly *ReadOnlyError
+		if err := write(); !errors.As(err, &readOnly) {
+			t.Fatalf("expected %s to fail with a *ReadOnlyError, got: %v", name, err)
+		}
+	}
+	if _, err := c.LoadRaw("ITEM_A"); err != nil {
+		t.Fatalf(err.Error())
+	}
+}
+
+// TestPayloadSizes checks the sizes of the bodies sent and received are reported
+func TestPayloadSizes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		size := 4096
+		if r.URL.Path == "/item/ITEM_B/annotations" {
+			// larger than drained on close, so only its declared size is known
+			size = 1 << 20
+			w.Header().Set("Content-Length", strconv.Itoa(size))
+		}
+		w.Write(bytes.Repeat([]byte("x"), size))
+	}))
+	defer server.Close()
+	var stats []CallStats
+	c := New(server.URL, "admin", "adm1n", &ClientOptions{
+		Timeout: 30 * time.Second,
+		OnCall:  func(s CallStats) { stats = append(stats, s) },
+	})
+	if err := c.SetAnnotations("ITEM_A", map[string]string{"a": "b"}); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(stats) != 1 || stats[0].RequestBytes != 9 || stats[0].ResponseBytes != 4096 {
+		t.Fatalf("unexpected payload sizes: %+v", stats)
+	}
+	if last := c.LastCall(); last == nil || last.ResponseBytes != 4096 {
+		t.Fatalf("unexpected last call: %+v", last)
+	}
+	if err := c.SetAnnotations("ITEM_B", map[string]string{"a": "b"}); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(stats) != 2 || stats[1].ResponseBytes != 1<<20 {
+		t.Fatalf("unexpected payload sizes: %+v", stats)
+	}
+}
+
+// TestStatusError checks errors identify the failed call without leaking the credentials
+func TestStatusError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("invalid value"))
+	}))
+	defer server.Close()
+	c := New(server.URL, "admin", "adm1n", &ClientOptions{Timeout: 30 * time.Second, DisableRetry: true})
+	_, err := c.LoadRaw("OPT_1")
+	if !errors.Is(err, ErrNotFound) || !strings.Contains(err.Error(), "GET /item/OPT_1 failed: 404 Not Found") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err = c.saveRaw("OPT_1", "T_1", []byte("{}"), nil)
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusBadRequest || statusErr.Message != "invalid value" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Contains(err.Error(), c.token) {
+		t.Fatalf("error leaks the credentials: %v", err)
+	}
+}
+
+// fakeClock a Clock whose time only moves when advanced
+type fakeClock struct {
+	lock    sync.Mutex
+	now     time.Time
+	waiters []fakeWaiter
+}
+
+type fakeWaiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now}
+}
+
+func (f *fakeClock) Now() time.Time {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.now
+}
+
+func (f *fakeClock) After(d time.Duration) <-chan time.Time {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- f.now
+		return ch
+	}
+	f.waiters = append(f.waiters, fakeWaiter{at: f.now.Add(d), ch: ch})
+	return ch
+}
+
+func (f *fakeClock) AfterFunc(d time.Duration, fn func()) Timer {
+	ch := f.After(d)
+	timer := &fakeTimer{stop: make(chan struct{})}
+	go func() {
+		select {
+		case <-ch:
+			fn()
+		case <-timer.stop:
+		}
+	}()
+	return timer
+}
+
+// fakeTimer a call scheduled on a fakeClock
+type fakeTimer struct {
+	once sync.Once
+	stop chan struct{}
+}
+
+func (t *fakeTimer) Stop() bool {
+	stopped := false
+	t.once.Do(func() {
+		close(t.stop)
+		stopped = true
+	})
+	return stopped
+}
+
+// Advance moves the time forward releasing the waits that have elapsed
+func (f *fakeClock) Advance(d time.Duration) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.now = f.now.Add(d)
+	waiting := f.waiters[:0]
+	for _, w := range f.waiters {
+		if w.at.After(f.now) {
+			waiting = append(waiting, w)
+			continue
+		}
+		w.ch <- f.now
+	}
+	f.waiters = waiting
+}
+
+// TestClock checks wildcard keys and cached schemas follow the clock of the client
+func TestClock(t *testing.T) {
+	var fetches int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		_, _ = w.Write([]byte(`{"key":"T_1","schema":"eyJ0eXBlIjoib2JqZWN0In0="}`))
+	}))
+	defer server.Close()
+	clock := newFakeClock(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+	c := New(server.URL, "admin", "adm1n", &ClientOptions{Timeout: 30 * time.Second, Clock: clock, SchemaCacheTTL: time.Minute})
+	if key := c.opts.KeyGenerator(); key != "20240102030405.000" {
+		t.Fatalf("unexpected key: %s", key)
+	}
+	for _, elapsed := range []time.Duration{0, 30 * time.Second, time.Minute} {
+		clock.Advance(elapsed)
+		if err := c.ValidateAgainstType("T_1", map[string]any{}); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	// the schema expires a minute after it was fetched
+	if fetches != 2 {
+		t.Fatalf("expected 2 fetches, got %d", fetches)
+	}
+	// the waits between attempts only elapse as the clock is advanced
+	var attempts int
+	done := make(chan error, 1)
+	go func() {
+		done <- retryWith(context.Background(), clock, RetryPolicy{}, func() error {
+			if attempts++; attempts < 3 {
+				return &StatusError{StatusCode: http.StatusServiceUnavailable}
+			}
+			return nil
+		})
+	}()
+	for {
+		select {
+		case err := <-done:
+			if err != nil || attempts != 3 {
+				t.Fatalf("expected 3 attempts, got %d: %v", attempts, err)
+			}
+			return
+		case <-time.After(10 * time.Millisecond):
+			clock.Advance(time.Minute)
+		}
+	}
+}
+
+// TestCompressValues checks values are stored compressed and inflated when loaded, and legacy values loaded as stored
+func TestCompressValues(t *testing.T) {
+	var (
+		lock     sync.Mutex
+		stored   []byte
+		encoding string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		if r.Method == http.MethodPut {
+			stored, _ = io.ReadAll(r.Body)
+			encoding = r.Header.Get("Source-Value-Encoding")
+			return
+		}
+		item := I{Key: "ITEM_A", Type: "T_1", Value: stored, Encoding: encoding}
+		if strings.HasPrefix(r.URL.Path, "/item/type/") {
+			_ = json.NewEncoder(w).Encode(IL{item})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(item)
+	}))
+	defer server.Close()
+	c := New(server.URL, "admin", "adm1n", &ClientOptions{Timeout: 30 * time.Second, CompressValues: true})
+	value := []byte(fmt.Sprintf(`{"hosts":"%s"}`, strings.Repeat("a", 4096)))
+	if err := c.saveRaw("ITEM_A", "T_1", value, nil); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if encoding != "gzip" || len(stored) >= len(value) {
+		t.Fatalf("expected the value to be stored compressed, got %d bytes encoded as '%s'", len(stored), encoding)
+	}
+	item, err := c.LoadRaw("ITEM_A")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !bytes.Equal(item.Value, value) || len(item.Encoding) > 0 {
+		t.Fatalf("unexpected value: %s", item.Value)
+	}
+	if item, err = c.PopOldestRaw("T_1"); err != nil || !bytes.Equal(item.Value, value) {
+		t.Fatalf("unexpected popped value: %v", err)
+	}
+	// values that cannot be inflated fail the call rather than being returned compressed
+	stored = []byte("not gzip")
+	if _, err = c.LoadItemsByTypeRaw("T_1"); err == nil {
+		t.Fatalf("expected the list to fail")
+	}
+	// items saved before compression was enabled
+	stored, encoding = []byte(`{"hosts":"a"}`), ""
+	if item, err = c.LoadRaw("ITEM_A"); err != nil || string(item.Value) != `{"hosts":"a"}` {
+		t.Fatalf("unexpected value: %v, %v", item, err)
+	}
+}
+
+// TestDiagnose checks the stages are reported up to the first that fails
+func TestDiagnose(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	c := New(server.URL, "admin", "adm1n", &ClientOptions{Timeout: 30 * time.Second, InsecureSkipVerify: true})
+	d, err := c.Diagnose(context.Background())
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if d.Failed() != nil || len(d.Stages) != 4 || len(d.Certificates) == 0 {
+		t.Fatalf("unexpected diagnostics:\n%s", d)
+	}
+	server.Close()
+	if d, err = c.Diagnose(context.Background()); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if failed := d.Failed(); failed == nil || failed.Name != StageConnect || len(d.Stages) != 2 {
+		t.Fatalf("expected the connection to fail:\n%s", d)
+	}
+}
+
+// TestMethodOverride checks requests other than GET are sent as POST carrying their actual method
+func TestMethodOverride(t *testing.T) {
+	var (
+		lock    sync.Mutex
+		methods []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		methods = append(methods, r.Method+" "+r.Header.Get("X-HTTP-Method-Override"))
+		lock.Unlock()
+		if r.Method == http.MethodGet {
+			_ = json.NewEncoder(w).Encode(I{Key: "ITEM_A", Type: "T_1", Value: []byte("{}")})
+		}
+	}))
+	defer server.Close()
+	var calls, ops []string
+	c := New(server.URL, "admin", "adm1n", &ClientOptions{
+		Timeout:        30 * time.Second,
+		MethodOverride: true,
+		OnCall:         func(stats CallStats) { calls = append(calls, stats.Method) },
+		OnBody:         func(op string, _, _ []byte, _ int) { ops = append(ops, op) },
+	})
+	if err := c.saveRaw("ITEM_A", "T_1", []byte("{}"), nil); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := c.Delete("ITEM_A"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, err := c.LoadRaw("ITEM_A"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	expected := []string{"POST PUT", "POST DELETE", "GET "}
+	if fmt.Sprint(methods) != fmt.Sprint(expected) {
+		t.Fatalf("expected %q, got %q", expected, methods)
+	}
+	// the hooks report the actual method
+	if expected = []string{"PUT", "DELETE", "GET"}; fmt.Sprint(calls) != fmt.Sprint(expected) {
+		t.Fatalf("expected calls %q, got %q", expected, calls)
+	}
+	if expected = []string{"PUT /item/ITEM_A", "DELETE /item/ITEM_A", "GET /item/ITEM_A"}; fmt.Sprint(ops) != fmt.Sprint(expected) {
+		t.Fatalf("expected ops %q, got %q", expected, ops)
+	}
+}
+
+// TestLoadAndWatch checks watching is reported as unsupported rather than polled
+func TestLoadAndWatch(t *testing.T) {
+	c := New("http://127.0.0.1:8999", "admin", "adm1n", nil)
+	if _, _, _, err := c.LoadAndWatch(context.Background(), "ITEM_A", &map[string]int{}); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("expected an unsupported error, got: %v", err)
+	}
+}
+
+// TestSaveStream checks large values are streamed in a single attempt reported like any other call
+func TestSaveStream(t *testing.T) {
+	var (
+		lock   sync.Mutex
+		stored []byte
+		header string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		stored, _ = io.ReadAll(r.Body)
+		header = r.Header.Get("X-Request-Id")
+	}))
+	defer server.Close()
+	var calls []CallStats
+	c := New(server.URL, "admin", "adm1n", &ClientOptions{
+		Timeout:         30 * time.Second,
+		StreamThreshold: 4,
+		OnCall:          func(stats CallStats) { calls = append(calls, stats) },
+	})
+	value := `{"hosts":["a","b"]}`
+	if err := c.WithOptions(WithHeader("X-Request-Id", "r1")).SaveStream("ITEM_A", "AAA", strings.NewReader(value)); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if string(stored) != value || header != "r1" {
+		t.Fatalf("unexpected value '%s' saved with request id '%s'", stored, header)
+	}
+	if len(calls) != 1 || calls[0].Method != http.MethodPut || calls[0].Attempts != 1 {
+		t.Fatalf("unexpected calls: %+v", calls)
+	}
+}
+
+// TestTxUnsupported checks the operations are only applied one by one if the server confirms it lacks transactions
+// and the client allows it
+func TestTxUnsupported(t *testing.T) {
+	var (
+		lock    sync.Mutex
+		txCode  int
+		deletes int
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		switch {
+		case r.URL.Path == "/tx":
+			w.WriteHeader(txCode)
+		case r.Method == http.MethodDelete:
+			deletes++
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	ops := func(tx *Transaction) error {
+		tx.Delete("ITEM_A")
+		return nil
+	}
+	c := New(server.URL, "admin", "adm1n", &ClientOptions{Timeout: 30 * time.Second, DisableRetry: true})
+	// a 404 might come from a proxy, it does not prove the server lacks transactions
+	txCode = http.StatusNotFound
+	if err := c.Tx(ops); err == nil || errors.Is(err, ErrUnsupported) {
+		t.Fatalf("expected the commit to fail, got: %v", err)
+	}
+	txCode = http.StatusNotImplemented
+	if err := c.Tx(ops); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("expected ErrUnsupported, got: %v", err)
+	}
+	if deletes != 0 {
+		t.Fatalf("expected no operation to be applied, got %d", deletes)
+	}
+	c = New(server.URL, "admin", "adm1n", &ClientOptions{Timeout: 30 * time.Second, DisableRetry: true, BestEffortTx: true})
+	if err := c.Tx(ops); err != nil || deletes != 1 {
+		t.Fatalf("expected the operations to be applied one by one, got %d: %v", deletes, err)
+	}
+}
+
+// TestTxLinkRollback checks reverting link operations restores the links as they were, with their attributes
+func TestTxLinkRollback(t *testing.T) {
+	var lock sync.Mutex
+	links := map[string]map[string]string{
+		"ITEM_B": {"relation": "depends-on"},
+		"ITEM_C": {"weight": "10"},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		to := strings.TrimPrefix(r.URL.Path, "/link/ITEM_A/to/")
+		switch {
+		case r.URL.Path == "/tx":
+			w.WriteHeader(http.StatusNotImplemented)
+		case r.URL.Path == "/item/ITEM_A/link":
+			var result []L
+			for key, attrs := range links {
+				result = append(result, L{From: "ITEM_A", To: key, Attributes: attrs})
+			}
+			_ = json.NewEncoder(w).Encode(result)
+		case r.Method == http.MethodPut && to != r.URL.Path:
+			var attrs map[string]string
+			_ = json.NewDecoder(r.Body).Decode(&attrs)
+			links[to] = attrs
+		case r.Method == http.MethodDelete && to != r.URL.Path:
+			delete(links, to)
+		case r.URL.Path == "/item/ITEM_X" && r.Method == http.MethodGet:
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+	c := New(server.URL, "admin", "adm1n", &ClientOptions{Timeout: 30 * time.Second, DisableRetry: true, BestEffortTx: true})
+	err := c.Tx(func(tx *Transaction) error {
+		tx.Link("ITEM_A", "ITEM_B")
+		tx.Unlink("ITEM_A", "ITEM_C")
+		tx.Link("ITEM_A", "ITEM_D")
+		tx.Delete("ITEM_X")
+		return nil
+	})
+	if err == nil || !strings.Contains(err.Error(), "rolled back") {
+		t.Fatalf("expected the transaction to be rolled back, got: %v", err)
+	}
+	expected := map[string]map[string]string{
+		"ITEM_B": {"relation": "depends-on"},
+		"ITEM_C": {"weight": "10"},
+	}
+	if fmt.Sprint(links) != fmt.Sprint(expected) {
+		t.Fatalf("expected the links to be restored, got: %v", links)
+	}
+}
+
+// TestTxFeature checks a server reporting it lacks transactions is only used one operation at a time if allowed
+func TestTxFeature(t *testing.T) {
+	var posts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/info" {
+			_, _ = w.Write([]byte(`{"version":"1.0.0","features":["reindex"]}`))
+			return
+		}
+		if r.URL.Path == "/tx" {
+			atomic.AddInt32(&posts, 1)
+		}
+	}))
+	defer server.Close()
+	c := New(server.URL, "admin", "adm1n", &ClientOptions{Timeout: 30 * time.Second})
+	err := c.Tx(func(tx *Transaction) error {
+		tx.Link("ITEM_A", "ITEM_B")
+		return nil
+	})
+	if !errors.Is(err, ErrUnsupported) || posts != 0 {
+		t.Fatalf("expected ErrUnsupported without committing, got: %v", err)
+	}
+}
+
+// TestReindexWait checks waiting for a rebuild gives up on a timeout and on unknown states
+func TestReindexWait(t *testing.T) {
+	var state atomic.Value
+	state.Store("running")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/reindex":
+			w.WriteHeader(http.StatusAccepted)
+		case "/reindex/status":
+			_ = json.NewEncoder(w).Encode(ReindexStatus{State: state.Load().(string), Progress: 0.5})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	c := New(server.URL, "admin", "adm1n", &ClientOptions{Timeout: 30 * time.Second})
+	opts := ReindexOptions{Wait: true, PollInterval: 10 * time.Millisecond, Timeout: 50 * time.Millisecond}
+	if err := c.Reindex(opts); err == nil || !strings.Contains(err.Error(), "still running") {
+		t.Fatalf("expected the wait to time out, got: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	opts.Timeout = time.Hour
+	if err := c.ReindexContext(ctx, opts); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the context to end the wait, got: %v", err)
+	}
+	state.Store("")
+	if err := c.Reindex(opts); err == nil || !strings.Contains(err.Error(), "unknown state") {
+		t.Fatalf("expected an unknown state to fail the wait, got: %v", err)
+	}
+}
+
+// TestLoadWithRetryUntilDeadline checks a read retrying a failing server does not outlive the context
+func TestLoadWithRetryUntilDeadline(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	c := New(server.URL, "admin", "adm1n", &ClientOptions{Timeout: 30 * time.Second})
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := c.LoadWithRetryUntil(ctx, "ITEM_A", &map[string]any{}, nil)
+	if !errors.Is(err, context.DeadlineExceeded) || time.Since(start) > time.Second {
+		t.Fatalf("expected the deadline to end the read, got %v after %s", err, time.Since(start))
+	}
+}
+
+// TestDeletedExcluded checks soft-deleted items are left out of searches, windows and pops by default
+func TestDeletedExcluded(t *testing.T) {
+	var pops int32
+	now := time.Now().UTC()
+	items := IL{{Key: "ITEM_A", Type: "T_1", Updated: now, Deleted: true}, {Key: "ITEM_B", Type: "T_1", Updated: now}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/item/pop/") {
+			_ = json.NewEncoder(w).Encode(items[atomic.AddInt32(&pops, 1)-1])
+			return
+		}
+		_ = json.NewEncoder(w).Encode(items)
+	}))
+	defer server.Close()
+	c := New(server.URL, "admin", "adm1n", &ClientOptions{Timeout: 30 * time.Second})
+	found, err := c.Search("a", SearchOptions{})
+	if err != nil || len(found) != 1 || found[0].Key != "ITEM_B" {
+		t.Fatalf("unexpected search results %v: %v", found, err)
+	}
+	updated, err := c.UpdatedBetween("T_1", now.Add(-time.Minute), now.Add(time.Minute))
+	if err != nil || len(updated) != 1 || updated[0].Key != "ITEM_B" {
+		t.Fatalf("unexpected items %v: %v", updated, err)
+	}
+	popped, err := c.PopOldestRaw("T_1")
+	if err != nil || popped.Key != "ITEM_B" || pops != 2 {
+		t.Fatalf("expected the deleted item to be skipped, got %v: %v", popped, err)
+	}
+}
+
+// TestWithOptionsCaches checks copies pointed at another server or with other credentials do not share its caches
+func TestWithOptionsCaches(t *testing.T) {
+	var calls int32
+	newServer := func(version string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			_ = json.NewEncoder(w).Encode(ServerInfo{Version: version})
+		}))
+	}
+	first, second := newServer("1.0.0"), newServer("2.0.0")
+	defer first.Close()
+	defer second.Close()
+	c := New(first.URL, "admin", "adm1n", &ClientOptions{Timeout: 30 * time.Second})
+	for _, tc := range []struct {
+		client  *Client
+		version string
+		calls   int32
+	}{
+		{c, "1.0.0", 1},
+		{c.WithOptions(WithHeader("X-Tenant", "default")), "1.0.0", 1},
+		{c.WithOptions(WithHost(second.URL)), "2.0.0", 2},
+		{c.WithOptions(WithCredentials("reader", "r3ad3r")), "1.0.0", 3},
+	} {
+		info, err := tc.client.ServerInfo()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if info.Version != tc.version || atomic.LoadInt32(&calls) != tc.calls {
+			t.Fatalf("expected version %s after %d calls, got %s after %d", tc.version, tc.calls, info.Version, calls)
+		}
+	}
+}
+
+// TestEnqueueSameTime checks items enqueued at the same time do not overwrite each other
+func TestEnqueueSameTime(t *testing.T) {
+	var lock sync.Mutex
+	items := map[string][]byte{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		key := strings.TrimPrefix(r.URL.Path, "/item/")
+		if _, exists := items[key]; exists && r.Header.Get("If-None-Match") == "*" {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		items[key], _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+	c := New(server.URL, "admin", "adm1n", &ClientOptions{
+		Timeout: 30 * time.Second,
+		Clock:   newFakeClock(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)),
+	})
+	queue, err := NewQueue[idValue](c, "JOB")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	for id := int64(1); id <= 2; id++ {
+		if err = queue.Enqueue(idValue{ID: id}); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	if len(items) != 2 {
+		t.Fatalf("expected 2 items to be enqueued, got: %v", items)
+	}
+	for key := range items {
+		if !strings.HasPrefix(key, "JOB_20220101000000.000_") {
+			t.Fatalf("unexpected key %s", key)
+		}
+	}
+}
+
+// TestLoadUpdatedAfter checks the items updated in the same millisecond as the cursor are returned after its key
+func TestLoadUpdatedAfter(t *testing.T) {
+	at := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	items := IL{
+		{Key: "ITEM_C", Type: "T_1", Updated: at},
+		{Key: "ITEM_D", Type: "T_1", Updated: at.Add(time.Millisecond)},
+		{Key: "ITEM_A", Type: "T_1", Updated: at},
+		{Key: "ITEM_B", Type: "T_1", Updated: at},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(items)
+	}))
+	defer server.Close()
+	c := New(server.URL, "admin", "adm1n", &ClientOptions{Timeout: 30 * time.Second})
+	after, err := c.LoadUpdatedAfter("T_1", at, "ITEM_A")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	keys := func(items IL) string {
+		var result []string
+		for _, item := range items {
+			result = append(result, item.Key)
+		}
+		return strings.Join(result, " ")
+	}
+	if keys(after) != "ITEM_B ITEM_C ITEM_D" {
+		t.Fatalf("unexpected items %s", keys(after))
+	}
+	between, err := c.UpdatedBetween("T_1", at, at.Add(time.Second))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if keys(between) != "ITEM_A ITEM_B ITEM_C ITEM_D" {
+		t.Fatalf("unexpected items %s", keys(between))
+	}
+}
@@ -0,0 +1,44 @@
+/*
+  Source Configuration Service
+  © 2022 Southwinds Tech Ltd - www.southwinds.io
+  Licensed under the Apache License, Version 2.0 at http://www.apache.org/licenses/LICENSE-2.0
+  Contributors to this project, hereby assign copyright in this code to the project,
+  to be licensed under the same terms as the rest of the code.
+*/
+
+package src
+
+import "time"
+
+// Clock the source of the time used by the client, e.g. to generate wildcard keys, expire cached schemas, flush
+// coalesced saves and wait between health or reindex checks; the waits between the retries of a call are made
+// inside retryablehttp, and those of Retry, which has no client, only use the system clock
+type Clock interface {
+	// Now the current time
+	Now() time.Time
+	// After sends the current time on the returned channel once the duration has elapsed
+	After(d time.Duration) <-chan time.Time
+	// AfterFunc calls f in its own goroutine once the duration has elapsed
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer a call scheduled by Clock.AfterFunc
+type Timer interface {
+	// Stop prevents the call if it has not happened yet, returning false if it has already happened or been stopped
+	Stop() bool
+}
+
+// realClock the Clock of the time package
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
@@ -0,0 +1,174 @@
+/*
+  Source Configuration Service
+  © 2022 Southwinds Tech Ltd - www.southwinds.io
+  Licensed under the Apache License, Version 2.0 at http://www.apache.org/licenses/LICENSE-2.0
+  Contributors to this project, hereby assign copyright in this code to the project,
+  to be licensed under the same terms as the rest of the code.
+*/
+
+package src
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultCoalesceInterval the minimum time between flushes of coalesced saves if not specified in the client options
+	defaultCoalesceInterval = time.Second
+	// defaultDrainTimeout the time Close waits for the pending work to complete
+	defaultDrainTimeout = 30 * time.Second
+)
+
+// coalescer buffers the latest value saved for each key and flushes them periodically
+type coalescer struct {
+	lock sync.Mutex
+	// flushLock serialises the flushes so that a flush waits for one in progress and values are saved in order
+	flushLock sync.Mutex
+	pending   map[string]coalescedSave
+	// order the keys in the order they were first buffered
+	order []string
+	timer Timer
+	// errs the errors of the background flushes not yet reported
+	errs []error
+	// closed true once the client is drained, no more items are buffered
+	closed bool
+}
+
+// coalescedSave a save waiting to be flushed
+type coalescedSave struct {
+	itemType string
+	item     Valid
+}
+
+func newCoalescer() *coalescer {
+	return &coalescer{pending: map[string]coalescedSave{}}
+}
+
+// SaveCoalesced buffers the item and saves it at most once per CoalesceInterval
+// if the same key is saved again before the buffer is flushed, only the latest value is saved
+// so it suits writers updating the same keys many times per second
+// the item is validated immediately, but errors saving it are only reported by Flush or Close
+// keys with wildcards are not allowed as they would never coalesce
+func (c *Client) SaveCoalesced(key, itemType string, item Valid) error {
+	if err := item.Validate(); err != nil {
+		return err
+	}
+	if reflect.ValueOf(item).Kind() == reflect.Ptr {
+		return fmt.Errorf("item argument passed to SaveCoalesced() must not be a pointer")
+	}
+	if len(itemType) == 0 {
+		return fmt.Errorf("item type is required to validate the item data")
+	}
+	if strings.Contains(key, "?") {
+		return fmt.Errorf("key '%s' passed to SaveCoalesced() must not contain wildcards", key)
+	}
+	co := c.coalescer
+	co.lock.Lock()
+	defer co.lock.Unlock()
+	if co.closed {
+		return ErrClosed
+	}
+	if _, buffered := co.pending[key]; !buffered {
+		co.order = append(co.order, key)
+	}
+	co.pending[key] = coalescedSave{itemType: itemType, item: item}
+	if co.timer == nil {
+		interval := c.opts.CoalesceInterval
+		if interval <= 0 {
+			interval = defaultCoalesceInterval
+		}
+		co.timer = c.opts.Clock.AfterFunc(interval, c.flushCoalesced)
+	}
+	return nil
+}
+
+// flushCoalesced saves the buffered items recording the errors found, once any flush in progress has completed
+func (c *Client) flushCoalesced() {
+	co := c.coalescer
+	co.flushLock.Lock()
+	defer co.flushLock.Unlock()
+	co.lock.Lock()
+	if co.timer != nil {
+		co.timer.Stop()
+		co.timer = nil
+	}
+	pending, order := co.pending, co.order
+	co.pending, co.order = map[string]coalescedSave{}, nil
+	co.lock.Unlock()
+	var errs []error
+	for _, key := range order {
+		save := pending[key]
+		if err := c.Save(key, save.itemType, save.item); err != nil {
+			errs = append(errs, fmt.Errorf("cannot save coalesced item '%s': %s", key, err))
+		}
+	}
+	co.lock.Lock()
+	co.errs = append(co.errs, errs...)
+	co.lock.Unlock()
+}
+
+// Flush saves any buffered coalesced items immediately and waits for the queued asynchronous saves to complete
+// a background flush in progress is waited for first, so that the values are saved in the order they were buffered
+// returns the errors found saving coalesced items, including those of previous background flushes
+// the errors of asynchronous saves are reported on the channels returned by SaveAsync
+func (c *Client) Flush() error {
+	c.waitAsync()
+	c.flushCoalesced()
+	co := c.coalescer
+	co.lock.Lock()
+	errs := co.errs
+	co.errs = nil
+	co.lock.Unlock()
+	return joinErrors(errs)
+}
+
+// Drain stops accepting asynchronous and coalesced saves, then waits for the queued asynchronous saves
+// and any background flush in progress to complete, and saves the buffered coalesced items
+// returns the errors found saving coalesced items, or the context error if it is done before the work completes,
+// in which case the remaining work carries on in the background
+// saves submitted after Drain fail with ErrClosed
+func (c *Client) Drain(ctx context.Context) error {
+	c.closeAsync()
+	co := c.coalescer
+	co.lock.Lock()
+	co.closed = true
+	co.lock.Unlock()
+	done := make(chan error, 1)
+	go func() {
+		c.async.workers.Wait()
+		done <- c.Flush()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("cannot drain pending saves: %w", ctx.Err())
+	}
+}
+
+// Close drains the pending work before the client is discarded, waiting at most 30 seconds
+func (c *Client) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultDrainTimeout)
+	defer cancel()
+	return c.Drain(ctx)
+}
+
+// joinErrors combines multiple errors into one, nil if there are none
+func joinErrors(errs []error) error {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	}
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return fmt.Errorf("%d errors: %s", len(errs), strings.Join(msgs, "; "))
+}
@@ -0,0 +1,85 @@
+/*
+  Source Configuration Service
+  © 2022 Southwinds Tech Ltd - www.southwinds.io
+  Licensed under the Apache License, Version 2.0 at http://www.apache.org/licenses/LICENSE-2.0
+  Contributors to this project, hereby assign copyright in this code to the project,
+  to be licensed under the same terms as the rest of the code.
+*/
+
+package src
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// Codec serializes item values, allowing a different json implementation to be plugged in
+type Codec interface {
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// defaultCodec preserves the precision of large integers when decoding into interface{} values
+var defaultCodec = JSONCodec{UseNumber: true}
+
+// JSONCodec the default codec based on encoding/json
+type JSONCodec struct {
+	// UseNumber decodes numbers into json.Number instead of float64 when the target is an interface{}
+	UseNumber bool
+}
+
+func (c JSONCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (c JSONCodec) Unmarshal(data []byte, v any) error {
+	if !c.UseNumber {
+		return json.Unmarshal(data, v)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// CanonicalJSONCodec marshals values as canonical json so that equal values always serialize to the same bytes:
+// object members sorted by name at every level, including within json.RawMessage values and custom marshallers,
+// no insignificant whitespace and no HTML escaping; e.g. for stable content hashes and meaningful diffs
+type CanonicalJSONCodec struct {
+	// Codec the codec the values are marshalled with before being canonicalized and unmarshalled with, defaults to JSONCodec
+	Codec Codec
+}
+
+func (c CanonicalJSONCodec) inner() Codec {
+	if c.Codec == nil {
+		return defaultCodec
+	}
+	return c.Codec
+}
+
+func (c CanonicalJSONCodec) Marshal(v any) ([]byte, error) {
+	data, err := c.inner().Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return canonicalJSON(data)
+}
+
+func (c CanonicalJSONCodec) Unmarshal(data []byte, v any) error {
+	return c.inner().Unmarshal(data, v)
+}
+
+// canonicalJSON re-encodes a json document with sorted object members, preserving the numbers as written
+func canonicalJSON(data []byte) ([]byte, error) {
+	var v any
+	if err := defaultCodec.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	// maps are encoded with sorted keys
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
@@ -0,0 +1,94 @@
+/*
+  Source Configuration Service
+  © 2022 Southwinds Tech Ltd - www.southwinds.io
+  Licensed under the Apache License, Version 2.0 at http://www.apache.org/licenses/LICENSE-2.0
+  Contributors to this project, hereby assign copyright in this code to the project,
+  to be licensed under the same terms as the rest of the code.
+*/
+
+package src
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+const (
+	// valueEncodingHeader the header recording the encoding an item value is stored with
+	valueEncodingHeader = "Source-Value-Encoding"
+	// gzipEncoding the encoding of values compressed using CompressValues
+	gzipEncoding = "gzip"
+	// compressMinSize the size from which values are compressed using CompressValues, as smaller ones barely shrink
+	compressMinSize = 1024
+)
+
+// compressValue the value to store and the headers recording its encoding, compressed if the client is set to
+func (c *Client) compressValue(value []byte, headers http.Header) ([]byte, http.Header, error) {
+	if !c.opts.CompressValues || len(value) < compressMinSize || len(headers.Get(valueEncodingHeader)) > 0 {
+		return value, headers, nil
+	}
+	var compressed bytes.Buffer
+	w := gzip.NewWriter(&compressed)
+	if _, err := w.Write(value); err != nil {
+		return nil, nil, fmt.Errorf("cannot compress value: %s", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, nil, fmt.Errorf("cannot compress value: %s", err)
+	}
+	encoded := headers.Clone()
+	if encoded == nil {
+		encoded = http.Header{}
+	}
+	encoded.Set(valueEncodingHeader, gzipEncoding)
+	return compressed.Bytes(), encoded, nil
+}
+
+// received prepares an item returned by the source server, inflating its value if it is stored compressed
+func (c *Client) received(item *I) error {
+	item.codec = c.opts.Codec
+	return c.decodeValue(item)
+}
+
+// receivedAll prepares the items returned by the source server, see received
+func (c *Client) receivedAll(items IL) (IL, error) {
+	for i := range items {
+		if err := c.received(&items[i]); err != nil {
+			return nil, err
+		}
+	}
+	return items, nil
+}
+
+// decodeValue inflates the value of the item if it is stored compressed, clearing its encoding
+// items without an encoding, e.g. saved before compression was enabled, are left as they are, as are items
+// returned without their value, e.g. listed using WithMetadataOnly
+func (c *Client) decodeValue(item *I) error {
+	if len(item.Value) == 0 {
+		return nil
+	}
+	switch item.Encoding {
+	case "":
+		return nil
+	case gzipEncoding:
+		r, err := gzip.NewReader(bytes.NewReader(item.Value))
+		if err != nil {
+			return fmt.Errorf("cannot inflate value of item '%s': %s", item.Key, err)
+		}
+		defer r.Close()
+		limit := c.maxResponseBytes()
+		value, err := io.ReadAll(io.LimitReader(r, limit+1))
+		if err != nil {
+			return fmt.Errorf("cannot inflate value of item '%s': %s", item.Key, err)
+		}
+		if int64(len(value)) > limit {
+			return &ResponseTooLargeError{Limit: limit}
+		}
+		item.Value, item.Encoding = value, ""
+		return nil
+	default:
+		return fmt.Errorf("cannot decode value of item '%s': unsupported encoding '%s'", item.Key, item.Encoding)
+	}
+}
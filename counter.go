@@ -0,0 +1,114 @@
+/*
+  Source Configuration Service
+  © 2022 Southwinds Tech Ltd - www.southwinds.io
+  Licensed under the Apache License, Version 2.0 at http://www.apache.org/licenses/LICENSE-2.0
+  Contributors to this project, hereby assign copyright in this code to the project,
+  to be licensed under the same terms as the rest of the code.
+*/
+
+package src
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+// maxIncrementAttempts the number of times an increment is attempted when the item is modified concurrently
+const maxIncrementAttempts = 10
+
+// Increment atomically adds delta to the integer at the RFC 6901 JSON Pointer in the value of the item
+// and returns the new value, e.g. for sequence numbers or usage tallies shared by several processes
+// the item is read and saved conditionally on its version, starting over if it was modified in between, so no
+// increment is lost, nor applied twice if the save is retried after an attempt whose response was lost; it fails if the value at the pointer is not an integer or the server does not version items
+func (c *Client) Increment(key, jsonPointer string, delta int64) (int64, error) {
+	tokens, err := pointerTokens(jsonPointer)
+	if err != nil {
+		return 0, err
+	}
+	var conflict error
+	for attempt := 0; attempt < maxIncrementAttempts; attempt++ {
+		item, loadErr := c.LoadRaw(key, ConsistentRead())
+		if loadErr != nil {
+			return 0, loadErr
+		}
+		if len(item.Version) == 0 {
+			return 0, fmt.Errorf("cannot increment item '%s': the source server does not return item versions", key)
+		}
+		decoder := json.NewDecoder(bytes.NewReader(item.Value))
+		decoder.UseNumber()
+		var value any
+		if err = decoder.Decode(&value); err != nil {
+			return 0, fmt.Errorf("cannot unmarshal value of item '%s': %s", key, err)
+		}
+		var result int64
+		if value, err = incrementAt(value, tokens, jsonPointer, delta, &result); err != nil {
+			return 0, err
+		}
+		valueBytes, marshalErr := json.Marshal(value)
+		if marshalErr != nil {
+			return 0, marshalErr
+		}
+		condition, matchErr := ifMatch(item.Version)
+		if matchErr != nil {
+			return 0, matchErr
+		}
+		err = c.saveRaw(key, item.Type, valueBytes, http.Header{"If-Match": []string{condition}})
+		if err == nil {
+			return result, nil
+		}
+		var conflictErr *ConflictError
+		if !errors.As(err, &conflictErr) {
+			return 0, err
+		}
+		// an earlier attempt whose response was lost may have saved the increment, in which case the value is the one sent
+		if conflictErr.retried {
+			if stored, loadErr := c.LoadRaw(key, ConsistentRead()); loadErr == nil && sameContent(stored.Value, valueBytes) {
+				return result, nil
+			}
+		}
+		conflict = err
+	}
+	return 0, fmt.Errorf("cannot increment item '%s' after %d attempts: %w", key, maxIncrementAttempts, conflict)
+}
+
+// incrementAt adds delta to the integer the tokens point to within value, returning the updated value
+func incrementAt(value any, tokens []string, pointer string, delta int64, result *int64) (any, error) {
+	if len(tokens) == 0 {
+		number, ok := value.(json.Number)
+		if !ok {
+			return nil, fmt.Errorf("cannot increment value at '%s': it is not a number", pointer)
+		}
+		n, err := number.Int64()
+		if err != nil {
+			return nil, fmt.Errorf("cannot increment value at '%s': %s is not an integer", pointer, number)
+		}
+		if (delta > 0 && n > math.MaxInt64-delta) || (delta < 0 && n < math.MinInt64-delta) {
+			return nil, fmt.Errorf("cannot increment value at '%s': %d overflows", pointer, n)
+		}
+		*result = n + delta
+		return json.Number(strconv.FormatInt(*result, 10)), nil
+	}
+	var err error
+	switch v := value.(type) {
+	case map[string]any:
+		member, ok := v[tokens[0]]
+		if !ok {
+			return nil, fmt.Errorf("json pointer '%s' does not resolve: no member '%s'", pointer, tokens[0])
+		}
+		v[tokens[0]], err = incrementAt(member, tokens[1:], pointer, delta, result)
+		return v, err
+	case []any:
+		ix, convErr := strconv.Atoi(tokens[0])
+		if convErr != nil || ix < 0 || ix >= len(v) {
+			return nil, fmt.Errorf("json pointer '%s' does not resolve: invalid array index '%s'", pointer, tokens[0])
+		}
+		v[ix], err = incrementAt(v[ix], tokens[1:], pointer, delta, result)
+		return v, err
+	}
+	return nil, fmt.Errorf("json pointer '%s' does not resolve: '%s' is not within an object or array", pointer, tokens[0])
+}
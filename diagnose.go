@@ -0,0 +1,164 @@
+/*
+  Source Configuration Service
+  © 2022 Southwinds Tech Ltd - www.southwinds.io
+  Licensed under the Apache License, Version 2.0 at http://www.apache.org/licenses/LICENSE-2.0
+  Contributors to this project, hereby assign copyright in this code to the project,
+  to be licensed under the same terms as the rest of the code.
+*/
+
+package src
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// the stages checked by Diagnose, in order
+const (
+	StageDNS     = "dns"
+	StageConnect = "connect"
+	StageTLS     = "tls"
+	StageHealth  = "health"
+)
+
+// Diagnostics the result of checking the connectivity to the source server stage by stage, see Diagnose
+type Diagnostics struct {
+	// URL the url of the source server
+	URL string
+	// Addresses the addresses the host of the source server resolved to
+	Addresses []string
+	// Certificates the certificate chain presented by the source server, empty if it does not use TLS
+	Certificates []CertificateInfo
+	// Stages the stages checked, in order, up to and including the first that failed
+	Stages []StageResult
+}
+
+// StageResult the outcome of a stage of Diagnose
+type StageResult struct {
+	// Name the stage, e.g. StageConnect
+	Name string
+	// Duration the time the stage took
+	Duration time.Duration
+	// Err why the stage failed, nil if it succeeded
+	Err error
+}
+
+// CertificateInfo the details of a certificate presented by the source server
+type CertificateInfo struct {
+	Subject  string
+	Issuer   string
+	DNSNames []string
+	NotAfter time.Time
+	// Expired true if the certificate was no longer valid at the time of the check
+	Expired bool
+}
+
+// Failed the first stage that failed, nil if the source server is reachable and healthy
+func (d *Diagnostics) Failed() *StageResult {
+	for i := range d.Stages {
+		if d.Stages[i].Err != nil {
+			return &d.Stages[i]
+		}
+	}
+	return nil
+}
+
+func (d *Diagnostics) String() string {
+	lines := []string{fmt.Sprintf("source server %s", d.URL)}
+	for _, stage := range d.Stages {
+		outcome := "ok"
+		if stage.Err != nil {
+			outcome = fmt.Sprintf("failed: %s", stage.Err)
+		}
+		lines = append(lines, fmt.Sprintf("  %s (%s): %s", stage.Name, stage.Duration.Round(time.Millisecond), outcome))
+	}
+	for _, cert := range d.Certificates {
+		lines = append(lines, fmt.Sprintf("  certificate %s issued by %s expires %s", cert.Subject, cert.Issuer, cert.NotAfter.Format(time.RFC3339)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Diagnose checks the connectivity to the source server stage by stage, e.g. to tell a support engineer why a client
+// cannot reach it: it resolves the host, connects to it, performs the TLS handshake reporting the certificate chain,
+// and finally checks the health of the server using the credentials of the client; the stages stop at the first that
+// fails, which is reported by Diagnostics.Failed; the TLS settings of the client are used
+// returns an error only if the url of the source server is invalid
+func (c *Client) Diagnose(ctx context.Context) (*Diagnostics, error) {
+	u, err := url.Parse(c.host)
+	if err != nil || len(u.Hostname()) == 0 {
+		return nil, fmt.Errorf("invalid source server url '%s'", c.host)
+	}
+	d := &Diagnostics{URL: c.host}
+	host, port := u.Hostname(), u.Port()
+	if len(port) == 0 {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	stage := func(name string, check func() error) bool {
+		start := c.opts.Clock.Now()
+		checkErr := check()
+		d.Stages = append(d.Stages, StageResult{Name: name, Duration: c.opts.Clock.Now().Sub(start), Err: checkErr})
+		return checkErr == nil
+	}
+	ok := stage(StageDNS, func() error {
+		addrs, lookupErr := net.DefaultResolver.LookupHost(ctx, host)
+		d.Addresses = addrs
+		return lookupErr
+	})
+	var conn net.Conn
+	ok = ok && stage(StageConnect, func() error {
+		var dialer net.Dialer
+		var dialErr error
+		conn, dialErr = dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, port))
+		return dialErr
+	})
+	if conn != nil {
+		defer conn.Close()
+	}
+	if ok && u.Scheme == "https" {
+		ok = stage(StageTLS, func() error {
+			return d.handshake(ctx, conn, c.tlsConfig(), host, c.opts.Clock.Now())
+		})
+	}
+	if ok {
+		stage(StageHealth, func() error {
+			return c.health(ctx)
+		})
+	}
+	return d, nil
+}
+
+// handshake performs the TLS handshake over the connection recording the certificate chain presented
+func (d *Diagnostics) handshake(ctx context.Context, conn net.Conn, config *tls.Config, host string, now time.Time) error {
+	if len(config.ServerName) == 0 {
+		config.ServerName = host
+	}
+	tlsConn := tls.Client(conn, config)
+	err := tlsConn.HandshakeContext(ctx)
+	for _, cert := range tlsConn.ConnectionState().PeerCertificates {
+		d.Certificates = append(d.Certificates, CertificateInfo{
+			Subject:  cert.Subject.String(),
+			Issuer:   cert.Issuer.String(),
+			DNSNames: cert.DNSNames,
+			NotAfter: cert.NotAfter,
+			Expired:  now.After(cert.NotAfter),
+		})
+	}
+	return err
+}
+
+// tlsConfig a copy of the TLS configuration of the client transport
+func (c *Client) tlsConfig() *tls.Config {
+	if transport, ok := c.HTTPClient.Transport.(*http.Transport); ok && transport.TLSClientConfig != nil {
+		return transport.TLSClientConfig.Clone()
+	}
+	return &tls.Config{InsecureSkipVerify: c.opts.InsecureSkipVerify}
+}
@@ -0,0 +1,221 @@
+/*
+  Source Configuration Service
+  © 2022 Southwinds Tech Ltd - www.southwinds.io
+  Licensed under the Apache License, Version 2.0 at http://www.apache.org/licenses/LICENSE-2.0
+  Contributors to this project, hereby assign copyright in this code to the project,
+  to be licensed under the same terms as the rest of the code.
+*/
+
+package src
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/hashicorp/go-retryablehttp"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// JSONChange a change between two json values
+type JSONChange struct {
+	// Op one of add, remove or replace
+	Op string `json:"op"`
+	// Path the JSON Pointer to the value changed, empty for the whole value
+	Path string `json:"path"`
+	// From the value before the change, nil for additions
+	From json.RawMessage `json:"from,omitempty"`
+	// To the value after the change, nil for removals
+	To json.RawMessage `json:"to,omitempty"`
+}
+
+func (c JSONChange) String() string {
+	switch c.Op {
+	case "add":
+		return fmt.Sprintf("+ %s: %s", c.Path, c.To)
+	case "remove":
+		return fmt.Sprintf("- %s: %s", c.Path, c.From)
+	}
+	return fmt.Sprintf("~ %s: %s -> %s", c.Path, c.From, c.To)
+}
+
+// JSONDiff the field-level changes between two json values, ordered by path
+// objects are compared member by member and arrays element by element
+type JSONDiff struct {
+	Changes []JSONChange `json:"changes"`
+}
+
+// Empty true if the values are equal
+func (d JSONDiff) Empty() bool {
+	return len(d.Changes) == 0
+}
+
+func (d JSONDiff) String() string {
+	changes := make([]string, len(d.Changes))
+	for i, change := range d.Changes {
+		changes[i] = change.String()
+	}
+	return strings.Join(changes, "\n")
+}
+
+// Diff the changes required to turn the value of item keyA into the value of item keyB
+func (c *Client) Diff(keyA, keyB string) (JSONDiff, error) {
+	a, err := c.LoadRaw(keyA)
+	if err != nil {
+		return JSONDiff{}, err
+	}
+	b, err := c.LoadRaw(keyB)
+	if err != nil {
+		return JSONDiff{}, err
+	}
+	return DiffJSON(a.Value, b.Value)
+}
+
+// DiffVersions the changes made to the value of the item between versionA and versionB
+// returns ErrNotFound if the item or either version does not exist, and ErrUnsupported if the server does not keep versions
+func (c *Client) DiffVersions(key, versionA, versionB string) (JSONDiff, error) {
+	a, err := c.loadVersion(key, versionA)
+	if err != nil {
+		return JSONDiff{}, err
+	}
+	b, err := c.loadVersion(key, versionB)
+	if err != nil {
+		return JSONDiff{}, err
+	}
+	return DiffJSON(a.Value, b.Value)
+}
+
+// loadVersion the item as it was at the specified version
+func (c *Client) loadVersion(key, version string) (*I, error) {
+	query := url.Values{"version": []string{version}}
+	request, err := retryablehttp.NewRequest(http.MethodGet, c.url("/item/%s?%s", key, query.Encode()), nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Authorization", c.token)
+	request.Header.Set("User-Agent", UserAgent)
+	resp, reqErr := c.do(request)
+	if reqErr != nil {
+		return nil, reqErr
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return nil, notFoundError(resp, fmt.Sprintf("item '%s' version '%s'", key, version))
+	case http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return nil, ErrUnsupported
+	}
+	if resp.StatusCode > 299 {
+		return nil, statusError(resp, "cannot get item version")
+	}
+	body, readErr := c.readBody(resp)
+	if readErr != nil {
+		return nil, fmt.Errorf("cannot read response body: %w", readErr)
+	}
+	item := new(I)
+	err = c.opts.Codec.Unmarshal(body, item)
+	if err != nil {
+		return nil, fmt.Errorf("cannot unmarshal response body: %s", err)
+	}
+	// a server ignoring the version parameter returns the current version
+	if len(item.Version) > 0 && item.Version != version {
+		return nil, ErrUnsupported
+	}
+	if err = c.received(item); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// DiffJSON the changes required to turn the json value a into the json value b
+func DiffJSON(a, b []byte) (JSONDiff, error) {
+	var valueA, valueB any
+	if err := defaultCodec.Unmarshal(a, &valueA); err != nil {
+		return JSONDiff{}, fmt.Errorf("cannot unmarshal first value: %s", err)
+	}
+	if err := defaultCodec.Unmarshal(b, &valueB); err != nil {
+		return JSONDiff{}, fmt.Errorf("cannot unmarshal second value: %s", err)
+	}
+	var diff JSONDiff
+	if err := diffValues("", valueA, valueB, &diff); err != nil {
+		return JSONDiff{}, err
+	}
+	return diff, nil
+}
+
+func diffValues(path string, a, b any, diff *JSONDiff) error {
+	switch valueA := a.(type) {
+	case map[string]any:
+		if valueB, ok := b.(map[string]any); ok {
+			names := make([]string, 0, len(valueA)+len(valueB))
+			for name := range valueA {
+				names = append(names, name)
+			}
+			for name := range valueB {
+				if _, ok = valueA[name]; !ok {
+					names = append(names, name)
+				}
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				if err := diffMember(path+"/"+escapeToken(name), valueA, valueB, name, diff); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	case []any:
+		if valueB, ok := b.([]any); ok {
+			for i := 0; i < len(valueA) || i < len(valueB); i++ {
+				elementPath := fmt.Sprintf("%s/%d", path, i)
+				var err error
+				switch {
+				case i >= len(valueB):
+					err = diff.add("remove", elementPath, valueA[i], nil)
+				case i >= len(valueA):
+					err = diff.add("add", elementPath, nil, valueB[i])
+				default:
+					err = diffValues(elementPath, valueA[i], valueB[i], diff)
+				}
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+	if !containsValue([]any{a}, b) {
+		return diff.add("replace", path, a, b)
+	}
+	return nil
+}
+
+func diffMember(path string, a, b map[string]any, name string, diff *JSONDiff) error {
+	valueA, inA := a[name]
+	valueB, inB := b[name]
+	switch {
+	case !inB:
+		return diff.add("remove", path, valueA, nil)
+	case !inA:
+		return diff.add("add", path, nil, valueB)
+	}
+	return diffValues(path, valueA, valueB, diff)
+}
+
+func (d *JSONDiff) add(op, path string, from, to any) error {
+	change := JSONChange{Op: op, Path: path}
+	var err error
+	if op != "add" {
+		if change.From, err = json.Marshal(from); err != nil {
+			return err
+		}
+	}
+	if op != "remove" {
+		if change.To, err = json.Marshal(to); err != nil {
+			return err
+		}
+	}
+	d.Changes = append(d.Changes, change)
+	return nil
+}
@@ -0,0 +1,230 @@
+/*
+  Source Configuration Service
+  © 2022 Southwinds Tech Ltd - www.southwinds.io
+  Licensed under the Apache License, Version 2.0 at http://www.apache.org/licenses/LICENSE-2.0
+  Contributors to this project, hereby assign copyright in this code to the project,
+  to be licensed under the same terms as the rest of the code.
+*/
+
+package src
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ErrNotFound returned when the requested item or type does not exist
+var ErrNotFound = errors.New("not found")
+
+// ErrUnsupported returned when the source server does not offer the requested feature
+var ErrUnsupported = errors.New("operation not supported by the source server")
+
+// ErrUnauthorized matches the *AuthError returned when the source server rejects the credentials of the client
+var ErrUnauthorized = errors.New("unauthorized")
+
+// ErrForbidden matches the *AuthError returned when the credentials of the client do not grant access to the operation
+var ErrForbidden = errors.New("forbidden")
+
+// AuthError returned by every call the source server responds to with 401 Unauthorized or 403 Forbidden
+// these responses are not retried; use errors.Is(err, ErrUnauthorized) to e.g. refresh the credentials
+type AuthError struct {
+	// StatusCode either 401 or 403
+	StatusCode int
+	// Method the http method of the request
+	Method string
+	// Path the path of the request
+	Path string
+}
+
+func (e *AuthError) Error() string {
+	return fmt.Sprintf("%s %s failed: %d %s", e.Method, e.Path, e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+func (e *AuthError) Is(target error) bool {
+	return (target == ErrUnauthorized && e.StatusCode == http.StatusUnauthorized) ||
+		(target == ErrForbidden && e.StatusCode == http.StatusForbidden)
+}
+
+// authError the *AuthError of a 401 or 403 response, nil for any other response
+func authError(request *http.Request, resp *http.Response) error {
+	if resp.StatusCode != http.StatusUnauthorized && resp.StatusCode != http.StatusForbidden {
+		return nil
+	}
+	return &AuthError{StatusCode: resp.StatusCode, Method: requestMethod(request), Path: request.URL.Path}
+}
+
+// notImplemented true if the status code confirms the server does not implement the endpoint, unlike a 404 which
+// might also come from a proxy or a wrong path
+func notImplemented(statusCode int) bool {
+	return statusCode == http.StatusMethodNotAllowed || statusCode == http.StatusNotImplemented
+}
+
+// unsupported true if the status code indicates the server does not implement the endpoint
+func unsupported(statusCode int) bool {
+	return statusCode == http.StatusNotFound ||
+		statusCode == http.StatusMethodNotAllowed ||
+		statusCode == http.StatusNotImplemented
+}
+
+// AlreadyExistsError returned when a create-only save fails because an item with the key already exists
+type AlreadyExistsError struct {
+	// Key the key of the item
+	Key string
+	// retried true if the save was attempted more than once, so an earlier attempt might have created the item
+	retried bool
+}
+
+func (e *AlreadyExistsError) Error() string {
+	return fmt.Sprintf("item '%s' already exists", e.Key)
+}
+
+// ReadOnlyError returned by the calls that would modify the store when the client is read-only, see ClientOptions.ReadOnly
+type ReadOnlyError struct {
+	// Method the http method of the refused request
+	Method string
+	// Path the path of the refused request
+	Path string
+}
+
+func (e *ReadOnlyError) Error() string {
+	return fmt.Sprintf("cannot %s %s: the client is read-only", e.Method, e.Path)
+}
+
+// StatusError returned when the source server responds to a call with an unexpected status
+// it identifies the call by its method and path, never its headers, so it is safe to log
+type StatusError struct {
+	// Op what the call was for, e.g. "cannot get item"
+	Op string
+	// Method the http method of the request
+	Method string
+	// Path the path of the request
+	Path string
+	// StatusCode the status code of the response
+	StatusCode int
+	// Status the status of the response, e.g. "404 Not Found"
+	Status string
+	// Message the error message in the response body, if any
+	Message string
+	// Err the error the status maps to, e.g. ErrNotFound, if any
+	Err error
+}
+
+func (e *StatusError) Error() string {
+	msg := fmt.Sprintf("%s %s failed: %s", e.Method, e.Path, e.Status)
+	if len(e.Op) > 0 {
+		msg = fmt.Sprintf("%s: %s", e.Op, msg)
+	}
+	if len(e.Message) > 0 {
+		msg = fmt.Sprintf("%s, %s", msg, e.Message)
+	}
+	return msg
+}
+
+func (e *StatusError) Unwrap() error {
+	return e.Err
+}
+
+// RetriesExhaustedError returned when a call keeps failing until the client gives up retrying it, either after
+// the maximum number of attempts or once the MaxElapsedTime of the retry policy is reached
+// it wraps the error of the last failed attempt, e.g. a *StatusError with a 503 status
+type RetriesExhaustedError struct {
+	// Method the http method of the request
+	Method string
+	// Path the path of the request
+	Path string
+	// Attempts the number of attempts made
+	Attempts int
+	// Elapsed the time spent trying
+	Elapsed time.Duration
+	// Err the error of the last failed attempt
+	Err error
+}
+
+func (e *RetriesExhaustedError) Error() string {
+	return fmt.Sprintf("%s %s: giving up after %s and %d attempt(s): %s", e.Method, e.Path, e.Elapsed.Round(time.Millisecond), e.Attempts, e.Err)
+}
+
+func (e *RetriesExhaustedError) Unwrap() error {
+	return e.Err
+}
+
+// statusError the *StatusError of the response to a call made for op
+func statusError(resp *http.Response, op string) *StatusError {
+	e := &StatusError{Op: op, StatusCode: resp.StatusCode, Status: resp.Status}
+	if resp.Request != nil {
+		e.Method, e.Path = requestMethod(resp.Request), resp.Request.URL.Path
+	}
+	return e
+}
+
+// notFoundError the *StatusError wrapping ErrNotFound of a 404 response to a call for the resource
+func notFoundError(resp *http.Response, resource string) *StatusError {
+	e := statusError(resp, resource)
+	e.Err = ErrNotFound
+	return e
+}
+
+// ConflictError returned when a conditional operation fails because the item version has changed
+type ConflictError struct {
+	// Key the key of the item
+	Key string
+	// Version the version the operation was conditional on
+	Version string
+	// retried true if the save was attempted more than once, so an earlier attempt might have changed the version
+	retried bool
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("item '%s' does not match version '%s', it has been modified by someone else", e.Key, e.Version)
+}
+
+// EmptyResponseError returned when the source server responds successfully but without the expected body
+type EmptyResponseError struct {
+	// Method the http method of the request
+	Method string
+	// Path the path of the request
+	Path string
+	// Status the status of the response
+	Status string
+}
+
+func (e *EmptyResponseError) Error() string {
+	return fmt.Sprintf("%s %s: source server responded with '%s' but no content", e.Method, e.Path, e.Status)
+}
+
+// ResponseTooLargeError returned when a response body exceeds ClientOptions.MaxResponseBytes
+type ResponseTooLargeError struct {
+	// Method the http method of the request
+	Method string
+	// Path the path of the request
+	Path string
+	// Limit the maximum number of bytes allowed
+	Limit int64
+}
+
+func (e *ResponseTooLargeError) Error() string {
+	return fmt.Sprintf("%s %s: source server response exceeds the limit of %d bytes", e.Method, e.Path, e.Limit)
+}
+
+// VerificationError returned by SaveVerified when the value stored differs from the value sent
+type VerificationError struct {
+	// Key the key of the item
+	Key string
+	// Changes the differences between the value sent and the value stored
+	Changes []JSONChange
+	// Cause the reason the values could not be compared, if any
+	Cause error
+}
+
+func (e *VerificationError) Error() string {
+	if e.Cause != nil {
+		return fmt.Sprintf("cannot verify item '%s': %s", e.Key, e.Cause)
+	}
+	return fmt.Sprintf("item '%s' stored differs from the value sent:\n%s", e.Key, JSONDiff{Changes: e.Changes})
+}
+
+func (e *VerificationError) Unwrap() error {
+	return e.Cause
+}
@@ -0,0 +1,74 @@
+/*
+  Source Configuration Service
+  © 2022 Southwinds Tech Ltd - www.southwinds.io
+  Licensed under the Apache License, Version 2.0 at http://www.apache.org/licenses/LICENSE-2.0
+  Contributors to this project, hereby assign copyright in this code to the project,
+  to be licensed under the same terms as the rest of the code.
+*/
+
+package src
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ETag an entity tag identifying a revision of an item as per RFC 7232
+type ETag struct {
+	// Tag the opaque tag without quotes
+	Tag string
+	// Weak true if the tag only identifies a semantically equivalent revision, i.e. W/"tag"
+	Weak bool
+}
+
+// ParseETag parses an entity tag, e.g. "v1" or W/"v1"
+// unquoted tags, as some servers report item versions, are accepted as strong tags
+func ParseETag(value string) (ETag, error) {
+	value = strings.TrimSpace(value)
+	var etag ETag
+	if strings.HasPrefix(value, "W/") {
+		etag.Weak = true
+		value = value[2:]
+		if !strings.HasPrefix(value, `"`) {
+			return ETag{}, fmt.Errorf("invalid entity tag 'W/%s': a weak tag must be quoted", value)
+		}
+	}
+	if strings.HasPrefix(value, `"`) {
+		if len(value) < 2 || !strings.HasSuffix(value, `"`) {
+			return ETag{}, fmt.Errorf("invalid entity tag '%s': missing closing quote", value)
+		}
+		value = value[1 : len(value)-1]
+	}
+	if len(value) == 0 || strings.ContainsAny(value, "\" \t") {
+		return ETag{}, fmt.Errorf("invalid entity tag '%s'", value)
+	}
+	etag.Tag = value
+	return etag, nil
+}
+
+// String the entity tag as sent in headers
+func (e ETag) String() string {
+	if e.Weak {
+		return fmt.Sprintf(`W/"%s"`, e.Tag)
+	}
+	return fmt.Sprintf(`"%s"`, e.Tag)
+}
+
+// StrongMatch true if both tags are strong and equal, the comparison used by If-Match
+func (e ETag) StrongMatch(other ETag) bool {
+	return !e.Weak && !other.Weak && e.Tag == other.Tag
+}
+
+// WeakMatch true if the tags are equal regardless of either being weak, the comparison used by If-None-Match
+func (e ETag) WeakMatch(other ETag) bool {
+	return e.Tag == other.Tag
+}
+
+// ifMatch the If-Match header value for a conditional write on the version, sent as it was received
+// a weak tag never matches If-Match, so it fails here rather than with a spurious conflict
+func ifMatch(version string) (string, error) {
+	if etag, err := ParseETag(version); err == nil && etag.Weak {
+		return "", fmt.Errorf("version %s is a weak entity tag, it cannot be used for a conditional write", version)
+	}
+	return version, nil
+}
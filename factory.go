@@ -0,0 +1,116 @@
+/*
+  Source Configuration Service
+  © 2022 Southwinds Tech Ltd - www.southwinds.io
+  Licensed under the Apache License, Version 2.0 at http://www.apache.org/licenses/LICENSE-2.0
+  Contributors to this project, hereby assign copyright in this code to the project,
+  to be licensed under the same terms as the rest of the code.
+*/
+
+package src
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// factoryRegistry the factories creating empty instances of item values keyed by item type
+type factoryRegistry struct {
+	lock      sync.RWMutex
+	factories map[string]func() any
+}
+
+func newFactoryRegistry() *factoryRegistry {
+	return &factoryRegistry{factories: map[string]func() any{}}
+}
+
+func (r *factoryRegistry) get(itemType string) (func() any, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	factory, ok := r.factories[itemType]
+	if !ok {
+		return nil, fmt.Errorf("no factory registered for item type '%s', call RegisterFactory() first", itemType)
+	}
+	return factory, nil
+}
+
+// RegisterFactory registers the factory used to create empty instances of the values of the specified item type
+// once registered, a nil factory can be passed to the Load methods, e.g. LoadItemsByType(nil, "AAA"),
+// and the factory is looked up using the type of each item
+// the factory must return a pointer, e.g. func() any { return new(ClientOptions) }
+func (c *Client) RegisterFactory(itemType string, factory func() any) error {
+	if len(itemType) == 0 {
+		return fmt.Errorf("item type is required to register a factory")
+	}
+	if factory == nil {
+		return fmt.Errorf("factory for item type '%s' must not be nil", itemType)
+	}
+	c.factories.lock.Lock()
+	defer c.factories.lock.Unlock()
+	c.factories.factories[itemType] = factory
+	return nil
+}
+
+// FactoryOf a factory creating pointers to new zero values of the specified type using reflection
+// e.g. for tooling resolving the type of the items at runtime; a pointer type creates values of its element type
+func FactoryOf(t reflect.Type) (func() any, error) {
+	if t == nil {
+		return nil, fmt.Errorf("a type is required to create a factory")
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return func() any { return reflect.New(t).Interface() }, nil
+}
+
+// RegisterFactoryOf registers a factory creating new zero values of the type of the sample, see RegisterFactory
+// the sample can be a value or a pointer, e.g. RegisterFactoryOf("AAA", ClientOptions{})
+func (c *Client) RegisterFactoryOf(itemType string, sample any) error {
+	factory, err := FactoryOf(reflect.TypeOf(sample))
+	if err != nil {
+		return err
+	}
+	return c.RegisterFactory(itemType, factory)
+}
+
+// Factory the factory registered for the specified item type
+func (c *Client) Factory(itemType string) (func() any, error) {
+	return c.factories.get(itemType)
+}
+
+// typed converts the items using the factory or, if nil, the factory registered for the type of each item
+func (c *Client) typed(items IL, factory func() any) ([]any, error) {
+	if factory != nil {
+		return items.Typed(factory)
+	}
+	var ii []any
+	for _, item := range items {
+		f, err := c.factories.get(item.Type)
+		if err != nil {
+			return nil, err
+		}
+		i, err := convert(item, f)
+		if err != nil {
+			return nil, err
+		}
+		ii = append(ii, i)
+	}
+	return ii, nil
+}
+
+// typedMap converts the items, see typed, keyed by item key
+// returns an error if the server returned the same key more than once rather than silently dropping an item
+func (c *Client) typedMap(items IL, factory func() any) (map[string]any, error) {
+	values, err := c.typed(items, factory)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]any, len(items))
+	for i, item := range items {
+		if _, exists := m[item.Key]; exists {
+			return nil, fmt.Errorf("item '%s' returned more than once", item.Key)
+		}
+		m[item.Key] = values[i]
+	}
+	return m, nil
+}
@@ -0,0 +1,53 @@
+/*
+  Source Configuration Service
+  © 2022 Southwinds Tech Ltd - www.southwinds.io
+  Licensed under the Apache License, Version 2.0 at http://www.apache.org/licenses/LICENSE-2.0
+  Contributors to this project, hereby assign copyright in this code to the project,
+  to be licensed under the same terms as the rest of the code.
+*/
+
+package src
+
+import "sync"
+
+// defaultConcurrency the maximum number of concurrent requests made by operations that fan out
+const defaultConcurrency = 8
+
+// fanOut calls fn for each index in [0, n) using at most concurrency goroutines
+// it stops starting new calls after the first error, which is returned
+func fanOut(n, concurrency int, fn func(i int) error) error {
+	if concurrency <= 0 {
+		concurrency = defaultConcurrency
+	}
+	var (
+		wg       sync.WaitGroup
+		lock     sync.Mutex
+		firstErr error
+	)
+	slots := make(chan struct{}, concurrency)
+	for i := 0; i < n; i++ {
+		lock.Lock()
+		failed := firstErr != nil
+		lock.Unlock()
+		if failed {
+			break
+		}
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			if err := fn(i); err != nil {
+				lock.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				lock.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+	return firstErr
+}
@@ -0,0 +1,283 @@
+/*
+  Source Configuration Service
+  © 2022 Southwinds Tech Ltd - www.southwinds.io
+  Licensed under the Apache License, Version 2.0 at http://www.apache.org/licenses/LICENSE-2.0
+  Contributors to this project, hereby assign copyright in this code to the project,
+  to be licensed under the same terms as the rest of the code.
+*/
+
+package src
+
+import (
+	"fmt"
+	"github.com/hashicorp/go-retryablehttp"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// TraverseOptions the options used to traverse the graph of linked items
+type TraverseOptions struct {
+	// MaxDepth the maximum number of links followed from the root item (0 = no limit)
+	MaxDepth int
+	// Relation only follows links whose RelationAttribute matches it, empty follows all links
+	Relation string
+}
+
+// TraverseFunc is called once for each item reached by a traversal
+// depth: the number of links followed from the root item to reach the item
+// links: the links followed from the item to its children
+type TraverseFunc func(item I, depth int, links []L) error
+
+// Traverse walks the children of the root item breadth first calling fn once per item
+// items reachable through more than one path, including cycles, are only visited once
+// the traversal stops at the first error returned by fn
+func (c *Client) Traverse(rootKey string, opts TraverseOptions, fn TraverseFunc) error {
+	root, err := c.LoadRaw(rootKey)
+	if err != nil {
+		return err
+	}
+	type node struct {
+		item  I
+		depth int
+	}
+	visited := map[string]bool{rootKey: true}
+	queue := []node{{item: *root}}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		var followed []L
+		if opts.MaxDepth <= 0 || current.depth < opts.MaxDepth {
+			if followed, err = c.followLinks(current.item.Key, opts.Relation); err != nil {
+				return err
+			}
+		}
+		if len(followed) > 0 {
+			children, childErr := c.LoadChildrenRaw(current.item.Key)
+			if childErr != nil {
+				return childErr
+			}
+			targets := make(map[string]bool, len(followed))
+			for _, link := range followed {
+				targets[link.To] = true
+			}
+			for _, child := range children {
+				if targets[child.Key] && !visited[child.Key] {
+					visited[child.Key] = true
+					queue = append(queue, node{item: child, depth: current.depth + 1})
+				}
+			}
+		}
+		if err = fn(current.item, current.depth, followed); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// followLinks the links from the item matching the relation, all outgoing links if relation is empty
+func (c *Client) followLinks(itemKey, relation string) ([]L, error) {
+	links, err := c.GetLinks(itemKey)
+	if err != nil {
+		return nil, err
+	}
+	var followed []L
+	for _, link := range links {
+		if link.From != itemKey {
+			continue
+		}
+		if len(relation) > 0 && link.Attributes[RelationAttribute] != relation {
+			continue
+		}
+		followed = append(followed, link)
+	}
+	return followed, nil
+}
+
+// Node an item of a tree of linked items along with its children
+type Node struct {
+	// Key the key of the item
+	Key string `json:"key"`
+	// Type the type of the item
+	Type string `json:"type"`
+	// Value the item value as created by the factory
+	Value any `json:"value"`
+	// Link the link from the parent to the item, nil for the root
+	Link *L `json:"link,omitempty"`
+	// Children the nodes of the items the item links to
+	Children []*Node `json:"children,omitempty"`
+}
+
+// LoadTree the tree of the items reachable from the root item following their links, up to maxDepth links away
+// (0 = no limit), e.g. to render a configuration hierarchy or serialize a subtree; each value is created by factory
+// an item reachable through more than one path, including cycles, appears once, under the first parent it is
+// reached from breadth first; links to items that no longer exist are left out
+func (c *Client) LoadTree(factory func() any, rootKey string, maxDepth int) (*Node, error) {
+	root := &Node{Key: rootKey}
+	nodes := map[string]*Node{rootKey: root}
+	loaded := map[string]bool{}
+	err := c.Traverse(rootKey, TraverseOptions{MaxDepth: maxDepth}, func(item I, depth int, links []L) error {
+		node := nodes[item.Key]
+		value, err := convert(item, factory)
+		if err != nil {
+			return fmt.Errorf("cannot convert item '%s': %s", item.Key, err)
+		}
+		node.Type, node.Value = item.Type, value
+		loaded[item.Key] = true
+		for i := range links {
+			if _, exists := nodes[links[i].To]; exists {
+				continue
+			}
+			child := &Node{Key: links[i].To, Link: &links[i]}
+			nodes[child.Key] = child
+			node.Children = append(node.Children, child)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// the children not loaded by the traversal are dangling links
+	for _, node := range nodes {
+		children := node.Children[:0]
+		for _, child := range node.Children {
+			if loaded[child.Key] {
+				children = append(children, child)
+			}
+		}
+		node.Children = children
+	}
+	return root, nil
+}
+
+// LinkDegree the number of links to the item (in) and from the item (out), 0 and 0 if it has no links
+// e.g. to find hub or orphan items; the counts are read from the headers of a HEAD request so that the links
+// are not transferred, falling back to counting the links of the item if the server does not send the headers
+func (c *Client) LinkDegree(itemKey string) (in int, out int, err error) {
+	request, err := retryablehttp.NewRequest(http.MethodHead, c.url("/item/%s/link", itemKey), nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	request.Header.Set("Authorization", c.token)
+	request.Header.Set("User-Agent", UserAgent)
+	resp, reqErr := c.do(request)
+	if reqErr != nil {
+		return 0, 0, reqErr
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 300 {
+		inHeader, outHeader := resp.Header.Get("Source-Link-In"), resp.Header.Get("Source-Link-Out")
+		if len(inHeader) > 0 && len(outHeader) > 0 {
+			if in, err = strconv.Atoi(inHeader); err != nil {
+				return 0, 0, fmt.Errorf("cannot parse link count: %s", err)
+			}
+			if out, err = strconv.Atoi(outHeader); err != nil {
+				return 0, 0, fmt.Errorf("cannot parse link count: %s", err)
+			}
+			return in, out, nil
+		}
+	} else if !unsupported(resp.StatusCode) {
+		return 0, 0, statusError(resp, "cannot get item link count")
+	}
+	// a not found response might mean the endpoint is not supported, counting the links reports a missing item
+	links, err := c.GetLinks(itemKey)
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, link := range links {
+		if link.To == itemKey {
+			in++
+		}
+		if link.From == itemKey {
+			out++
+		}
+	}
+	return in, out, nil
+}
+
+// ExportGraphDOT writes the graph of items reachable from the root item in Graphviz DOT format
+// nodes are labelled with the item key and type, and edges with the link attributes
+// e.g. render it using: dot -Tsvg graph.dot -o graph.svg
+func (c *Client) ExportGraphDOT(rootKey string, opts TraverseOptions, w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "digraph %s {\n", dotQuote(rootKey)); err != nil {
+		return err
+	}
+	err := c.Traverse(rootKey, opts, func(item I, depth int, links []L) error {
+		if _, err := fmt.Fprintf(w, "  %s [label=%s];\n", dotQuote(item.Key), dotQuote(fmt.Sprintf("%s\n(%s)", item.Key, item.Type))); err != nil {
+			return err
+		}
+		for _, link := range links {
+			var attrs string
+			if len(link.Attributes) > 0 {
+				labels := make([]string, 0, len(link.Attributes))
+				for _, name := range sortedKeys(link.Attributes) {
+					labels = append(labels, fmt.Sprintf("%s=%s", name, link.Attributes[name]))
+				}
+				attrs = fmt.Sprintf(" [label=%s]", dotQuote(strings.Join(labels, "\n")))
+			}
+			if _, err := fmt.Fprintf(w, "  %s -> %s%s;\n", dotQuote(link.From), dotQuote(link.To), attrs); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, "}")
+	return err
+}
+
+// dotQuote quotes a DOT identifier escaping quotes, backslashes and new lines
+func dotQuote(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	value = strings.ReplaceAll(value, "\n", `\n`)
+	return `"` + value + `"`
+}
+
+// FindDanglingLinks the links whose from or to item no longer exists
+// the existence of the linked items is checked using a bounded number of concurrent calls
+func (c *Client) FindDanglingLinks() ([]L, error) {
+	links, err := c.ListLinks()
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	seen := map[string]bool{}
+	for _, link := range links {
+		for _, key := range []string{link.From, link.To} {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	exists, err := c.ExistsBatch(keys)
+	if err != nil {
+		return nil, err
+	}
+	var dangling []L
+	for _, link := range links {
+		if !exists[link.From] || !exists[link.To] {
+			dangling = append(dangling, link)
+		}
+	}
+	return dangling, nil
+}
+
+// PruneDanglingLinks removes the links whose from or to item no longer exists
+// returns the number of links removed
+func (c *Client) PruneDanglingLinks() (int, error) {
+	dangling, err := c.FindDanglingLinks()
+	if err != nil {
+		return 0, err
+	}
+	for i, link := range dangling {
+		if err = c.Unlink(link.From, link.To); err != nil {
+			return i, err
+		}
+	}
+	return len(dangling), nil
+}
@@ -0,0 +1,82 @@
+/*
+  Source Configuration Service
+  © 2022 Southwinds Tech Ltd - www.southwinds.io
+  Licensed under the Apache License, Version 2.0 at http://www.apache.org/licenses/LICENSE-2.0
+  Contributors to this project, hereby assign copyright in this code to the project,
+  to be licensed under the same terms as the rest of the code.
+*/
+
+package src
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	// defaultReadyInterval the initial wait between health checks if not specified
+	defaultReadyInterval = time.Second
+	// maxReadyBackoff the factor the wait between health checks can grow to relative to the initial interval
+	maxReadyBackoff = 8
+)
+
+// Health checks the source server is up and able to serve requests
+// unlike other calls, it makes a single attempt without retrying so that it reports the current state of the server
+func (c *Client) Health() error {
+	return c.health(context.Background())
+}
+
+func (c *Client) health(ctx context.Context) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url("/health"), nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", c.token)
+	request.Header.Set("User-Agent", UserAgent)
+	// bypasses the retrying client
+	resp, err := c.HTTPClient.Do(request)
+	if err != nil {
+		return fmt.Errorf("source server is not reachable: %w", err)
+	}
+	resp.Body.Close()
+	if authErr := authError(request, resp); authErr != nil {
+		return authErr
+	}
+	if resp.StatusCode > 299 {
+		return statusError(resp, "source server is not healthy")
+	}
+	return nil
+}
+
+// WaitReady blocks until the source server is healthy or the context is done, e.g. to hold the startup of a service
+// the health check is repeated after interval, doubling the wait after each failure up to 8 times the interval
+// if the context is done first, returns an error wrapping the last health check error
+// returns an *AuthError straight away if the server rejects the credentials of the client
+func (c *Client) WaitReady(ctx context.Context, interval time.Duration) error {
+	if interval <= 0 {
+		interval = defaultReadyInterval
+	}
+	wait := interval
+	for {
+		err := c.health(ctx)
+		if err == nil {
+			return nil
+		}
+		// waiting does not fix the credentials
+		var authErr *AuthError
+		if errors.As(err, &authErr) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("source server is not ready: %s: %w", ctx.Err(), err)
+		case <-c.opts.Clock.After(wait):
+		}
+		if wait < interval*maxReadyBackoff {
+			wait *= 2
+		}
+	}
+}
@@ -0,0 +1,70 @@
+/*
+  Source Configuration Service
+  © 2022 Southwinds Tech Ltd - www.southwinds.io
+  Licensed under the Apache License, Version 2.0 at http://www.apache.org/licenses/LICENSE-2.0
+  Contributors to this project, hereby assign copyright in this code to the project,
+  to be licensed under the same terms as the rest of the code.
+*/
+
+package src
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// defaultImportChunkSize the number of items imported between progress reports if not specified in the import options
+const defaultImportChunkSize = 100
+
+// ImportOptions the options used to import items in bulk
+type ImportOptions struct {
+	// ChunkSize the number of items imported before the progress is reported, defaults to 100
+	ChunkSize int
+	// Concurrency the maximum number of items saved at once, defaults to 8
+	Concurrency int
+	// OnProgress is called after each chunk with the number of items imported so far and the total, e.g. to render a progress bar
+	OnProgress func(done, total int)
+}
+
+// Import saves the raw items in chunks using a bounded number of concurrent calls
+// the items are saved as they are, without client-side validation, so it suits restoring items previously exported
+// the import stops at the end of the first chunk in which a save fails, returning the errors found in that chunk
+func (c *Client) Import(items IL, opts ImportOptions) error {
+	chunkSize := opts.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = defaultImportChunkSize
+	}
+	for _, item := range items {
+		if len(item.Key) == 0 || strings.Contains(item.Key, "?") {
+			return fmt.Errorf("invalid key '%s': imported items require a key without wildcards", item.Key)
+		}
+	}
+	for start := 0; start < len(items); start += chunkSize {
+		end := start + chunkSize
+		if end > len(items) {
+			end = len(items)
+		}
+		chunk := items[start:end]
+		var (
+			lock sync.Mutex
+			errs []error
+		)
+		// saves every item of the chunk so that all its errors are reported
+		_ = fanOut(len(chunk), opts.Concurrency, func(i int) error {
+			if err := c.saveRaw(chunk[i].Key, chunk[i].Type, chunk[i].Value, nil); err != nil {
+				lock.Lock()
+				errs = append(errs, fmt.Errorf("cannot import item '%s': %s", chunk[i].Key, err))
+				lock.Unlock()
+			}
+			return nil
+		})
+		if len(errs) > 0 {
+			return joinErrors(errs)
+		}
+		if opts.OnProgress != nil {
+			opts.OnProgress(end, len(items))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+/*
+  Source Configuration Service
+  © 2022 Southwinds Tech Ltd - www.southwinds.io
+  Licensed under the Apache License, Version 2.0 at http://www.apache.org/licenses/LICENSE-2.0
+  Contributors to this project, hereby assign copyright in this code to the project,
+  to be licensed under the same terms as the rest of the code.
+*/
+
+package src
+
+import (
+	"fmt"
+	"strings"
+)
+
+// KeyRules the rules item keys are checked against by ValidateKey
+type KeyRules struct {
+	// MaxLength the maximum number of characters of a key
+	MaxLength int
+	// AllowedChars the characters allowed besides the ASCII letters and digits
+	// only the characters left unescaped in a url path can be allowed, i.e. - . _ ~, as keys are sent as they are
+	AllowedChars string
+	// Reserved the tokens a key must not contain
+	Reserved []string
+}
+
+// DefaultKeyRules the rules used unless the client options set others
+// besides letters and digits, only the characters left unescaped in a url path are allowed, so a valid key is sent
+// as it is; "?" is reserved as the wildcard completed when saving and ".." as it could traverse the url path
+var DefaultKeyRules = KeyRules{
+	MaxLength:    255,
+	AllowedChars: unreservedChars,
+	Reserved:     []string{"?", ".."},
+}
+
+// unreservedChars the characters besides letters and digits left unescaped in a url, as per RFC 3986
+const unreservedChars = "-._~"
+
+// checkChars checks the allowed characters are all left unescaped in a url path, so that valid keys are sent as
+// they are; e.g. allowing "/" or "%" would send keys that point at another path
+func (r KeyRules) checkChars() error {
+	for _, c := range r.AllowedChars {
+		if !strings.ContainsRune(unreservedChars, c) {
+			return fmt.Errorf("invalid key rules: character '%c' cannot be allowed, only %s can", c, strings.Join(strings.Split(unreservedChars, ""), " "))
+		}
+	}
+	return nil
+}
+
+// String describes the rules, e.g. to display them next to a key input
+func (r KeyRules) String() string {
+	desc := fmt.Sprintf("letters, digits and %s", strings.Join(strings.Split(r.AllowedChars, ""), " "))
+	if r.MaxLength > 0 {
+		desc = fmt.Sprintf("%s, up to %d characters", desc, r.MaxLength)
+	}
+	if len(r.Reserved) > 0 {
+		desc = fmt.Sprintf("%s, without %s", desc, strings.Join(r.Reserved, " "))
+	}
+	return desc
+}
+
+// Validate checks the key follows the rules, failing for any key if the rules allow characters escaped in a url path
+func (r KeyRules) Validate(key string) error {
+	if err := r.checkChars(); err != nil {
+		return err
+	}
+	if len(key) == 0 {
+		return fmt.Errorf("invalid key: a key is required")
+	}
+	if r.MaxLength > 0 && len(key) > r.MaxLength {
+		return fmt.Errorf("invalid key '%s': it is longer than %d characters", key, r.MaxLength)
+	}
+	for _, c := range key {
+		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || strings.ContainsRune(r.AllowedChars, c) {
+			continue
+		}
+		return fmt.Errorf("invalid key '%s': character '%c' is not allowed, use %s", key, c, r)
+	}
+	for _, token := range r.Reserved {
+		if strings.Contains(key, token) {
+			return fmt.Errorf("invalid key '%s': '%s' is reserved", key, token)
+		}
+	}
+	return nil
+}
+
+// KeyRules the rules item keys are checked against by ValidateKey
+func (c *Client) KeyRules() KeyRules {
+	if c.opts.KeyRules != nil {
+		return *c.opts.KeyRules
+	}
+	return DefaultKeyRules
+}
+
+// ValidateKey checks the key client-side against the key rules, without calling the source server
+// e.g. to give fast feedback in forms and command lines; keys with the "?" wildcard must be completed first
+func (c *Client) ValidateKey(key string) error {
+	return c.KeyRules().Validate(key)
+}
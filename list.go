@@ -0,0 +1,150 @@
+/*
+  Source Configuration Service
+  © 2022 Southwinds Tech Ltd - www.southwinds.io
+  Licensed under the Apache License, Version 2.0 at http://www.apache.org/licenses/LICENSE-2.0
+  Contributors to this project, hereby assign copyright in this code to the project,
+  to be licensed under the same terms as the rest of the code.
+*/
+
+package src
+
+import (
+	"fmt"
+	"github.com/hashicorp/go-retryablehttp"
+	"net/url"
+	"sort"
+)
+
+// SortField the item field list results are sorted by
+type SortField string
+
+const (
+	// SortByKey sorts items by key
+	SortByKey SortField = "key"
+	// SortByUpdated sorts items by the time they were last updated
+	SortByUpdated SortField = "updated"
+)
+
+// SortOrder the direction list results are sorted in
+type SortOrder string
+
+const (
+	Ascending  SortOrder = "asc"
+	Descending SortOrder = "desc"
+)
+
+// TieBreakByKey the tie-breaker of the items updated at the same time, e.g. within the same millisecond, when
+// ordering them by update time: they are ordered by key, ascending for the oldest first and descending for the newest
+// first, so that PopOldest pops in the reverse order of PopNewest and both are deterministic
+const TieBreakByKey = "key"
+
+// listOptions the options applied to the calls returning lists of items
+type listOptions struct {
+	sortBy         SortField
+	order          SortOrder
+	metadataOnly   bool
+	includeDeleted bool
+}
+
+// WithSort sorts the items returned by the list methods: by type, by tag, by tag query, children and parents
+// the sorting is done by the source server; without it the order of the items is unspecified and may change between calls
+// items updated at the same time are sorted by key in the same order, see TieBreakByKey
+func WithSort(field SortField, order SortOrder) Option {
+	return func(c *Client) {
+		c.list.sortBy = field
+		c.list.order = order
+	}
+}
+
+// WithMetadataOnly makes the list methods return the items without their value, i.e. only their key, type and metadata
+// e.g. for browsing views that do not need the values; load the full item on demand using Load or LoadRaw
+// the source server is asked to omit the values, and they are dropped client-side if it does not
+// as items without values cannot be converted, use it with the Raw variants of the list methods
+func WithMetadataOnly() Option {
+	return func(c *Client) {
+		c.list.metadataOnly = true
+	}
+}
+
+// WithIncludeDeleted makes the list methods also return the soft-deleted items, flagged by I.Deleted
+// e.g. for audit tooling; without it soft-deleted items are excluded, see IncludeDeleted for single reads
+func WithIncludeDeleted() Option {
+	return func(c *Client) {
+		c.list.includeDeleted = true
+	}
+}
+
+// listURL the url of a list call adding the query parameters of the list options
+func (c *Client) listURL(query url.Values, format string, args ...any) string {
+	if query == nil {
+		query = url.Values{}
+	}
+	if len(c.list.sortBy) > 0 {
+		query.Set("sort", string(c.list.sortBy))
+		if len(c.list.order) > 0 {
+			query.Set("order", string(c.list.order))
+		}
+		if c.list.sortBy == SortByUpdated {
+			query.Set("tiebreak", TieBreakByKey)
+		}
+	}
+	path := fmt.Sprintf(format, args...)
+	if len(query) > 0 {
+		path = fmt.Sprintf("%s?%s", path, query.Encode())
+	}
+	return c.url("%s", path)
+}
+
+// sortByUpdated sorts the items oldest first, the items updated at the same time by key, see TieBreakByKey
+func sortByUpdated(items IL) {
+	sort.SliceStable(items, func(i, j int) bool {
+		if !items[i].Updated.Equal(items[j].Updated) {
+			return items[i].Updated.Before(items[j].Updated)
+		}
+		return items[i].Key < items[j].Key
+	})
+}
+
+// setListHeaders sets the headers of a list call required by the list options
+func (c *Client) setListHeaders(request *retryablehttp.Request) {
+	if c.list.metadataOnly {
+		request.Header.Set("Source-Omit-Value", "true")
+	}
+	if c.list.includeDeleted {
+		request.Header.Set(includeDeletedHeader, "true")
+	}
+}
+
+// listed prepares the items returned by a list call applying the list options
+func (c *Client) listed(items IL) (IL, error) {
+	if c.list.metadataOnly {
+		for i := range items {
+			items[i].Value = nil
+		}
+	}
+	items, err := c.receivedAll(items)
+	if err != nil {
+		return nil, err
+	}
+	// drops soft-deleted items in case the server returned them
+	if !c.list.includeDeleted {
+		live := items[:0]
+		for _, item := range items {
+			if !item.Deleted {
+				live = append(live, item)
+			}
+		}
+		items = live
+	}
+	// breaks the ties client-side in case the server did not
+	if c.list.sortBy == SortByUpdated {
+		descending := c.list.order == Descending
+		sort.SliceStable(items, func(i, j int) bool {
+			if !items[i].Updated.Equal(items[j].Updated) {
+				return items[i].Updated.Before(items[j].Updated) != descending
+			}
+			return items[i].Key < items[j].Key != descending
+		})
+	}
+	return items, nil
+}
@@ -0,0 +1,155 @@
+/*
+  Source Configuration Service
+  © 2022 Southwinds Tech Ltd - www.southwinds.io
+  Licensed under the Apache License, Version 2.0 at http://www.apache.org/licenses/LICENSE-2.0
+  Contributors to this project, hereby assign copyright in this code to the project,
+  to be licensed under the same terms as the rest of the code.
+*/
+
+package src
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ArrayMerge how arrays present in both the base and the overlay are merged
+type ArrayMerge int
+
+const (
+	// ArrayReplace the overlay array replaces the base array
+	ArrayReplace ArrayMerge = iota
+	// ArrayAppend the overlay elements are appended to the base elements
+	ArrayAppend
+	// ArrayUnion the overlay elements not already in the base array are appended to it
+	ArrayUnion
+)
+
+// ConflictMode how values present in both the base and the overlay, that cannot be merged, are resolved
+type ConflictMode int
+
+const (
+	// OverlayWins the overlay value is used
+	OverlayWins ConflictMode = iota
+	// BaseWins the base value is kept
+	BaseWins
+	// FailOnConflict the merge fails with a *MergeConflictError
+	FailOnConflict
+)
+
+// MergeStrategy controls how an overlay value is deep-merged onto a base value
+// objects are always merged member by member; the strategy applies to arrays and to the other values in both
+type MergeStrategy struct {
+	Arrays    ArrayMerge
+	Conflicts ConflictMode
+}
+
+// MergeConflictError returned when values in both the base and the overlay differ and the strategy is FailOnConflict
+type MergeConflictError struct {
+	// Paths the JSON Pointers to the conflicting values
+	Paths []string
+}
+
+func (e *MergeConflictError) Error() string {
+	return fmt.Sprintf("cannot merge values, they conflict at: %s", strings.Join(e.Paths, ", "))
+}
+
+// Merge deep-merges the value of the overlay item onto the value of the base item and saves the result
+// under resultKey, e.g. to layer environment overrides onto a base configuration
+// the result is validated against the json schema of itemType before it is saved
+func (c *Client) Merge(baseKey, overlayKey, resultKey, itemType string, strategy MergeStrategy) error {
+	if len(itemType) == 0 {
+		return fmt.Errorf("item type is required to validate the merged item")
+	}
+	if strings.Contains(resultKey, "?") {
+		return fmt.Errorf("key '%s' passed to Merge() must not contain wildcards", resultKey)
+	}
+	base, err := c.LoadRaw(baseKey)
+	if err != nil {
+		return err
+	}
+	overlay, err := c.LoadRaw(overlayKey)
+	if err != nil {
+		return err
+	}
+	var baseValue, overlayValue any
+	if err = base.unmarshal(&baseValue); err != nil {
+		return fmt.Errorf("cannot unmarshal value of item '%s': %s", baseKey, err)
+	}
+	if err = overlay.unmarshal(&overlayValue); err != nil {
+		return fmt.Errorf("cannot unmarshal value of item '%s': %s", overlayKey, err)
+	}
+	var conflicts []string
+	merged := mergeValues("", baseValue, overlayValue, strategy, &conflicts)
+	if len(conflicts) > 0 {
+		return &MergeConflictError{Paths: conflicts}
+	}
+	if err = c.ValidateAgainstType(itemType, merged); err != nil {
+		return err
+	}
+	value, err := c.opts.Codec.Marshal(merged)
+	if err != nil {
+		return err
+	}
+	return c.saveRaw(resultKey, itemType, value, nil)
+}
+
+// mergeValues deep-merges overlay onto base recording the paths of the conflicts if the strategy fails on them
+func mergeValues(path string, base, overlay any, strategy MergeStrategy, conflicts *[]string) any {
+	switch baseValue := base.(type) {
+	case map[string]any:
+		if overlayValue, ok := overlay.(map[string]any); ok {
+			merged := make(map[string]any, len(baseValue)+len(overlayValue))
+			for name, value := range baseValue {
+				merged[name] = value
+			}
+			names := make([]string, 0, len(overlayValue))
+			for name := range overlayValue {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				if existing, exists := baseValue[name]; exists {
+					merged[name] = mergeValues(path+"/"+escapeToken(name), existing, overlayValue[name], strategy, conflicts)
+				} else {
+					merged[name] = overlayValue[name]
+				}
+			}
+			return merged
+		}
+	case []any:
+		if overlayValue, ok := overlay.([]any); ok {
+			switch strategy.Arrays {
+			case ArrayAppend:
+				return append(append([]any{}, baseValue...), overlayValue...)
+			case ArrayUnion:
+				merged := append([]any{}, baseValue...)
+				for _, element := range overlayValue {
+					if !containsValue(merged, element) {
+						merged = append(merged, element)
+					}
+				}
+				return merged
+			}
+			// replacing an array is only a conflict if the arrays differ
+			return resolveConflict(path, baseValue, overlayValue, strategy, conflicts)
+		}
+	}
+	return resolveConflict(path, base, overlay, strategy, conflicts)
+}
+
+// resolveConflict the value to use when base and overlay cannot be merged
+func resolveConflict(path string, base, overlay any, strategy MergeStrategy, conflicts *[]string) any {
+	var diff JSONDiff
+	if err := diffValues(path, base, overlay, &diff); err == nil && diff.Empty() {
+		return base
+	}
+	switch strategy.Conflicts {
+	case BaseWins:
+		return base
+	case FailOnConflict:
+		*conflicts = append(*conflicts, path)
+	}
+	return overlay
+}
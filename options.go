@@ -0,0 +1,127 @@
+/*
+  Source Configuration Service
+  © 2022 Southwinds Tech Ltd - www.southwinds.io
+  Licensed under the Apache License, Version 2.0 at http://www.apache.org/licenses/LICENSE-2.0
+  Contributors to this project, hereby assign copyright in this code to the project,
+  to be licensed under the same terms as the rest of the code.
+*/
+
+package src
+
+import (
+	"context"
+	"github.com/hashicorp/go-retryablehttp"
+	"net/http"
+	"time"
+)
+
+// Option overrides a setting of a client derived using WithOptions
+type Option func(c *Client)
+
+// WithHost overrides the source server host
+func WithHost(host string) Option {
+	return func(c *Client) {
+		c.host = host
+	}
+}
+
+// WithCredentials overrides the credentials used to authenticate with the source server
+func WithCredentials(user, pwd string) Option {
+	return func(c *Client) {
+		c.token = authToken(c.opts.AuthScheme, user, pwd)
+	}
+}
+
+// WithHeader adds a header sent on every request
+// headers set by the client itself such as Authorization are not overridden
+func WithHeader(name, value string) Option {
+	return func(c *Client) {
+		c.headers.Add(name, value)
+	}
+}
+
+type requestHeadersKey struct{}
+
+// WithRequestHeaders returns a copy of the context carrying headers sent on the requests made with it
+// by the context-aware methods, e.g. to propagate a correlation or tenant id captured by a middleware
+// request headers take precedence over the headers added using WithHeader, but not over the headers set by the
+// client itself such as Authorization; headers already in the context are replaced by those with the same name
+func WithRequestHeaders(ctx context.Context, headers http.Header) context.Context {
+	merged := requestHeaders(ctx).Clone()
+	if merged == nil {
+		merged = http.Header{}
+	}
+	for name, values := range headers {
+		merged[http.CanonicalHeaderKey(name)] = values
+	}
+	return context.WithValue(ctx, requestHeadersKey{}, merged)
+}
+
+// requestHeaders the headers added to the context using WithRequestHeaders, nil if there are none
+func requestHeaders(ctx context.Context) http.Header {
+	headers, _ := ctx.Value(requestHeadersKey{}).(http.Header)
+	return headers
+}
+
+// WithTimeout overrides the timeout of each request attempt
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.opts.Timeout = timeout
+		c.HTTPClient.Timeout = timeout
+	}
+}
+
+// WithKeyGenerator overrides the generator of the value replacing the "?" wildcard in item keys
+// e.g. WithKeyGenerator(func() string { return "fixed" }) makes generated keys deterministic in tests
+func WithKeyGenerator(generator func() string) Option {
+	return func(c *Client) {
+		c.opts.KeyGenerator = generator
+	}
+}
+
+// WithOptions returns a copy of the client with the specified options applied
+// the copy shares the transport, and therefore the connection pool, of the original client
+// so that deriving clients for a subset of calls does not lose connection reuse
+// buffered work such as coalesced and asynchronous saves is not shared, so the copy must be closed separately
+// the cached schemas and server info and the retry budget are shared only while the copy calls the same server
+// with the same credentials
+func (c *Client) WithOptions(options ...Option) *Client {
+	httpClient := *c.HTTPClient
+	clone := &Client{
+		host:      c.host,
+		token:     c.token,
+		opts:      c.opts,
+		headers:   c.headers.Clone(),
+		list:      c.list,
+		factories: c.factories,
+		schemas:   c.schemas,
+		coalescer: newCoalescer(),
+		async:     newAsyncSaver(),
+		budget:    c.budget,
+		info:      c.info,
+		Client: &retryablehttp.Client{
+			HTTPClient:      &httpClient,
+			Logger:          c.Logger,
+			RetryWaitMin:    c.RetryWaitMin,
+			RetryWaitMax:    c.RetryWaitMax,
+			RetryMax:        c.RetryMax,
+			RequestLogHook:  c.RequestLogHook,
+			ResponseLogHook: c.ResponseLogHook,
+			ErrorHandler:    c.ErrorHandler,
+		},
+	}
+	if clone.headers == nil {
+		clone.headers = http.Header{}
+	}
+	clone.CheckRetry = clone.checkRetry
+	clone.Backoff = clone.backoff
+	for _, option := range options {
+		option(clone)
+	}
+	if clone.host != c.host || clone.token != c.token {
+		clone.schemas = newSchemaCache()
+		clone.info = &serverInfoCache{}
+		clone.budget = newRetryBudget(clone.opts.RetryPolicy, clone.opts.Clock)
+	}
+	return clone
+}
@@ -0,0 +1,84 @@
+/*
+  Source Configuration Service
+  © 2022 Southwinds Tech Ltd - www.southwinds.io
+  Licensed under the Apache License, Version 2.0 at http://www.apache.org/licenses/LICENSE-2.0
+  Contributors to this project, hereby assign copyright in this code to the project,
+  to be licensed under the same terms as the rest of the code.
+*/
+
+package src
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// pointerTokens splits an RFC 6901 JSON Pointer into its unescaped reference tokens
+func pointerTokens(pointer string) ([]string, error) {
+	if len(pointer) == 0 {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid json pointer '%s': it must be empty or start with '/'", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		// ~1 must be replaced before ~0 as per RFC 6901
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// resolvePointer extracts the value at the specified RFC 6901 JSON Pointer from a json document
+func resolvePointer(doc []byte, pointer string) (json.RawMessage, error) {
+	tokens, err := pointerTokens(pointer)
+	if err != nil {
+		return nil, err
+	}
+	// the escaped segments are used to report where the pointer failed to resolve
+	segments := strings.Split(pointer, "/")
+	value := json.RawMessage(doc)
+	for i, token := range tokens {
+		path := strings.Join(segments[:i+2], "/")
+		switch firstChar(value) {
+		case '{':
+			var obj map[string]json.RawMessage
+			if err = json.Unmarshal(value, &obj); err != nil {
+				return nil, err
+			}
+			v, ok := obj[token]
+			if !ok {
+				return nil, fmt.Errorf("json pointer '%s' does not resolve: no member at '%s'", pointer, path)
+			}
+			value = v
+		case '[':
+			var arr []json.RawMessage
+			if err = json.Unmarshal(value, &arr); err != nil {
+				return nil, err
+			}
+			ix, convErr := strconv.Atoi(token)
+			if convErr != nil || ix < 0 || ix >= len(arr) || (len(token) > 1 && token[0] == '0') {
+				return nil, fmt.Errorf("json pointer '%s' does not resolve: invalid array index at '%s'", pointer, path)
+			}
+			value = arr[ix]
+		default:
+			return nil, fmt.Errorf("json pointer '%s' does not resolve: '%s' is not an object or array", pointer, path)
+		}
+	}
+	return value, nil
+}
+
+// firstChar returns the first non-whitespace character of a json value
+func firstChar(value []byte) byte {
+	for _, c := range value {
+		switch c {
+		case ' ', '\t', '\r', '\n':
+			continue
+		default:
+			return c
+		}
+	}
+	return 0
+}
@@ -0,0 +1,85 @@
+/*
+  Source Configuration Service
+  © 2022 Southwinds Tech Ltd - www.southwinds.io
+  Licensed under the Apache License, Version 2.0 at http://www.apache.org/licenses/LICENSE-2.0
+  Contributors to this project, hereby assign copyright in this code to the project,
+  to be licensed under the same terms as the rest of the code.
+*/
+
+package src
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// maxEnqueueAttempts the number of keys tried by Enqueue if the ones generated are already taken
+const maxEnqueueAttempts = 3
+
+// Queue a typed first-in first-out work queue of the items of a type
+// items are enqueued using Save and dequeued using PopOldest, so several processes can share a queue;
+// a dequeued item is removed straight away, there is no visibility timeout to recover the items of failed consumers
+type Queue[T Valid] struct {
+	client   *Client
+	itemType string
+	// sorted the client used to peek at the oldest item
+	sorted *Client
+}
+
+// NewQueue creates a queue over the items of the specified type
+func NewQueue[T Valid](c *Client, itemType string) (*Queue[T], error) {
+	if len(itemType) == 0 {
+		return nil, fmt.Errorf("item type is required to create a queue")
+	}
+	return &Queue[T]{
+		client:   c,
+		itemType: itemType,
+		sorted:   c.WithOptions(WithSort(SortByUpdated, Ascending)),
+	}, nil
+}
+
+// Enqueue adds the item at the end of the queue
+// the item is saved create-only under a new unique key, so it never overwrites another item of the queue
+func (q *Queue[T]) Enqueue(item T) error {
+	var err error
+	for attempt := 0; attempt < maxEnqueueAttempts; attempt++ {
+		err = q.client.SaveIfNotExists(queueKey(q.itemType), q.itemType, item)
+		var exists *AlreadyExistsError
+		if !errors.As(err, &exists) {
+			return err
+		}
+	}
+	return err
+}
+
+// queueKey a key for an item of the queue: the wildcard completed by the key generator followed by a random suffix,
+// so that the items enqueued within the same millisecond, e.g. by several processes, get different keys
+func queueKey(itemType string) string {
+	suffix := make([]byte, 8)
+	_, _ = rand.Read(suffix)
+	return fmt.Sprintf("%s_?_%s", itemType, hex.EncodeToString(suffix))
+}
+
+// Dequeue removes and returns the item at the front of the queue, nil if the queue is empty
+func (q *Queue[T]) Dequeue() (*T, error) {
+	return PopOldestTyped[T](q.client, q.itemType)
+}
+
+// Peek the item at the front of the queue without removing it, nil if the queue is empty
+func (q *Queue[T]) Peek() (*T, error) {
+	items, err := q.sorted.LoadItemsByTypePage(q.itemType, 0, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, nil
+	}
+	return typedValue[T](&items[0], nil)
+}
+
+// Len the number of items in the queue
+func (q *Queue[T]) Len() (int, error) {
+	return q.client.Count(q.itemType)
+}
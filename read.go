@@ -0,0 +1,175 @@
+/*
+  Source Configuration Service
+  © 2022 Southwinds Tech Ltd - www.southwinds.io
+  Licensed under the Apache License, Version 2.0 at http://www.apache.org/licenses/LICENSE-2.0
+  Contributors to this project, hereby assign copyright in this code to the project,
+  to be licensed under the same terms as the rest of the code.
+*/
+
+package src
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/hashicorp/go-retryablehttp"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// pollMinWait the initial wait between the reads of LoadWithRetryUntil
+	pollMinWait = 100 * time.Millisecond
+	// pollMaxWait the maximum wait between the reads of LoadWithRetryUntil
+	pollMaxWait = 5 * time.Second
+)
+
+// ReadOption modifies a single read of an item, see Load and LoadRaw
+type ReadOption func(headers http.Header)
+
+// ConsistentRead reads the latest saved value of the item, e.g. to verify an item right after saving it
+// it asks the source server for a strong read from the primary store, and any intermediary cache to revalidate
+// consistent reads cannot be served by read replicas or caches so expect them to be slower than default reads
+func ConsistentRead() ReadOption {
+	return func(headers http.Header) {
+		headers.Set("Source-Consistency", "strong")
+		headers.Set("Cache-Control", "no-cache")
+	}
+}
+
+// includeDeletedHeader the request header asking the source server to return soft-deleted items
+const includeDeletedHeader = "Source-Include-Deleted"
+
+// IncludeDeleted reads the item even if it has been soft-deleted, flagged by I.Deleted, e.g. for forensic review
+// without it a soft-deleted item is not found
+func IncludeDeleted() ReadOption {
+	return func(headers http.Header) {
+		headers.Set(includeDeletedHeader, "true")
+	}
+}
+
+// readHeaders the request headers of the read options, nil if there are none
+func readHeaders(opts []ReadOption) http.Header {
+	if len(opts) == 0 {
+		return nil
+	}
+	headers := http.Header{}
+	for _, opt := range opts {
+		opt(headers)
+	}
+	return headers
+}
+
+// LoadWithRetryUntil loads the item, see Load, until predicate returns true for it or the context is done
+// e.g. to read your own writes against an eventually-consistent deployment where a saved item may not be visible yet
+// the wait between reads doubles from 100 milliseconds up to 5 seconds; the item not being found is considered transient,
+// other errors are returned straight away
+// if the context is done first, the error wraps ErrNotFound if the item was still not found, or the context error otherwise
+// the reads themselves are abandoned once the context is done
+func (c *Client) LoadWithRetryUntil(ctx context.Context, key string, prototype any, predicate func(any) bool) (any, error) {
+	wait := pollMinWait
+	notFound := false
+	for {
+		item, err := c.LoadContext(ctx, key, prototype)
+		if err == nil && (predicate == nil || predicate(item)) {
+			return item, nil
+		}
+		// a read cut short by the context does not tell whether the item exists
+		if ctx.Err() == nil {
+			if err != nil && !errors.Is(err, ErrNotFound) {
+				return nil, err
+			}
+			notFound = err != nil
+		}
+		select {
+		case <-ctx.Done():
+			if notFound {
+				return nil, fmt.Errorf("item '%s' still not found when giving up (%s): %w", key, ctx.Err(), ErrNotFound)
+			}
+			return nil, fmt.Errorf("item '%s' did not reach the expected state: %w", key, ctx.Err())
+		case <-c.opts.Clock.After(wait):
+		}
+		if wait *= 2; wait > pollMaxWait {
+			wait = pollMaxWait
+		}
+	}
+}
+
+// LoadRange writes the bytes from start to end, both inclusive, of the value of the item to w
+// e.g. to read the header or footer of a large value without retrieving all of it; returns the total size of the value
+// servers ignoring the range send the whole value, in which case the bytes outside the range are discarded
+func (c *Client) LoadRange(key string, start, end int64, w io.Writer) (int64, error) {
+	if start < 0 || end < start {
+		return 0, fmt.Errorf("invalid range %d-%d: start must not be negative nor greater than end", start, end)
+	}
+	request, err := retryablehttp.NewRequest(http.MethodGet, c.url("/item/%s/value", key), nil)
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Authorization", c.token)
+	request.Header.Set("User-Agent", UserAgent)
+	request.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+	// the range applies to the encoded bytes, so the value must not be compressed
+	request.Header.Set("Accept-Encoding", "identity")
+	resp, reqErr := c.do(request)
+	if reqErr != nil {
+		return 0, reqErr
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return 0, notFoundError(resp, fmt.Sprintf("item '%s'", key))
+	case http.StatusRequestedRangeNotSatisfiable:
+		return 0, rangeError(key, start, end)
+	case http.StatusPartialContent:
+		total, rangeErr := contentRangeTotal(resp.Header.Get("Content-Range"))
+		if rangeErr != nil {
+			return 0, rangeErr
+		}
+		if _, err = io.Copy(w, io.LimitReader(resp.Body, end-start+1)); err != nil {
+			return 0, fmt.Errorf("cannot read response body: %w", err)
+		}
+		return total, nil
+	case http.StatusOK:
+		// the server ignored the range and sent the whole value
+		skipped, skipErr := io.CopyN(io.Discard, resp.Body, start)
+		if skipErr != nil && skipErr != io.EOF {
+			return 0, fmt.Errorf("cannot read response body: %w", skipErr)
+		}
+		copied, copyErr := io.Copy(w, io.LimitReader(resp.Body, end-start+1))
+		if copyErr != nil {
+			return 0, fmt.Errorf("cannot read response body: %w", copyErr)
+		}
+		// the range holds at least one byte, so none left after skipping means it starts past the end of the value
+		if copied == 0 {
+			return 0, rangeError(key, start, end)
+		}
+		rest, restErr := io.Copy(io.Discard, resp.Body)
+		if restErr != nil {
+			return 0, fmt.Errorf("cannot read response body: %w", restErr)
+		}
+		return skipped + copied + rest, nil
+	}
+	return 0, statusError(resp, "cannot get item value range")
+}
+
+// rangeError the error of a range starting past the end of the value of the item
+func rangeError(key string, start, end int64) error {
+	return fmt.Errorf("range %d-%d is outside the value of item '%s'", start, end, key)
+}
+
+// contentRangeTotal the total size in a Content-Range header, e.g. "bytes 0-99/1234"
+func contentRangeTotal(contentRange string) (int64, error) {
+	i := strings.LastIndex(contentRange, "/")
+	if i < 0 || !strings.HasPrefix(contentRange, "bytes ") {
+		return 0, fmt.Errorf("invalid Content-Range '%s'", contentRange)
+	}
+	total := contentRange[i+1:]
+	if total == "*" {
+		return -1, nil
+	}
+	return strconv.ParseInt(total, 10, 64)
+}
@@ -0,0 +1,151 @@
+/*
+  Source Configuration Service
+  © 2022 Southwinds Tech Ltd - www.southwinds.io
+  Licensed under the Apache License, Version 2.0 at http://www.apache.org/licenses/LICENSE-2.0
+  Contributors to this project, hereby assign copyright in this code to the project,
+  to be licensed under the same terms as the rest of the code.
+*/
+
+package src
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/hashicorp/go-retryablehttp"
+	"net/http"
+	"time"
+)
+
+const (
+	// defaultReindexPollInterval the time between reindex status checks if not specified in the reindex options
+	defaultReindexPollInterval = 2 * time.Second
+	// defaultReindexTimeout the time Reindex waits for the rebuild to complete if not specified in the reindex options
+	defaultReindexTimeout = 30 * time.Minute
+)
+
+// ReindexOptions the options used to rebuild the data the source server derives from the items
+type ReindexOptions struct {
+	// Wait blocks until the rebuild completes, otherwise Reindex returns once it has started
+	Wait bool
+	// PollInterval the time between checks of the rebuild status when waiting, defaults to 2 seconds
+	PollInterval time.Duration
+	// Timeout the time to wait for the rebuild to complete when waiting, defaults to 30 minutes
+	Timeout time.Duration
+	// OnProgress is called with the status of the rebuild each time it is checked when waiting
+	OnProgress func(status ReindexStatus)
+}
+
+// ReindexStatus the status of a rebuild of the server-side derived data
+type ReindexStatus struct {
+	// State one of running, completed or failed
+	State string `json:"state"`
+	// Progress the fraction (0 to 1) of the rebuild completed
+	Progress float64 `json:"progress"`
+	// Message describes the current step, or the cause of the failure
+	Message string `json:"message,omitempty"`
+}
+
+// Reindex triggers a rebuild of the data the source server derives from the items, such as search indexes
+// and tag aggregates, e.g. after a bulk import; returns ErrUnsupported if the server does not offer it
+func (c *Client) Reindex(opts ReindexOptions) error {
+	return c.ReindexContext(context.Background(), opts)
+}
+
+// ReindexContext triggers a rebuild of the server-side derived data, see Reindex, giving up once the context is
+// done or, when waiting, once the timeout of the options has elapsed; waiting also fails if the server reports a
+// state other than running, completed or failed
+func (c *Client) ReindexContext(ctx context.Context, opts ReindexOptions) error {
+	if err := c.requireFeature(FeatureReindex); err != nil {
+		return err
+	}
+	request, err := retryablehttp.NewRequestWithContext(ctx, http.MethodPost, c.url("/reindex"), nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", c.token)
+	request.Header.Set("User-Agent", UserAgent)
+	resp, reqErr := c.do(request)
+	if reqErr != nil {
+		return reqErr
+	}
+	defer resp.Body.Close()
+	if unsupported(resp.StatusCode) {
+		return ErrUnsupported
+	}
+	if resp.StatusCode > 299 {
+		return statusError(resp, "cannot start reindex")
+	}
+	if !opts.Wait {
+		return nil
+	}
+	interval := opts.PollInterval
+	if interval <= 0 {
+		interval = defaultReindexPollInterval
+	}
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = defaultReindexTimeout
+	}
+	deadline := c.opts.Clock.After(timeout)
+	for {
+		status, statusErr := c.reindexStatus(ctx)
+		if statusErr != nil {
+			return statusErr
+		}
+		if opts.OnProgress != nil {
+			opts.OnProgress(*status)
+		}
+		switch status.State {
+		case "completed":
+			return nil
+		case "failed":
+			return fmt.Errorf("reindex failed: %s", status.Message)
+		case "running":
+		default:
+			return fmt.Errorf("cannot wait for reindex, source server reported an unknown state '%s'", status.State)
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("reindex still running when giving up: %w", ctx.Err())
+		case <-deadline:
+			return fmt.Errorf("reindex still running after %s, progress %.0f%%", timeout, status.Progress*100)
+		case <-c.opts.Clock.After(interval):
+		}
+	}
+}
+
+// ReindexStatus the status of the last rebuild of the server-side derived data
+func (c *Client) ReindexStatus() (*ReindexStatus, error) {
+	return c.reindexStatus(context.Background())
+}
+
+func (c *Client) reindexStatus(ctx context.Context) (*ReindexStatus, error) {
+	request, err := retryablehttp.NewRequestWithContext(ctx, http.MethodGet, c.url("/reindex/status"), nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Authorization", c.token)
+	request.Header.Set("User-Agent", UserAgent)
+	resp, reqErr := c.do(request)
+	if reqErr != nil {
+		return nil, reqErr
+	}
+	defer resp.Body.Close()
+	if unsupported(resp.StatusCode) {
+		return nil, ErrUnsupported
+	}
+	if resp.StatusCode > 299 {
+		return nil, statusError(resp, "cannot get reindex status")
+	}
+	body, readErr := c.readBody(resp)
+	if readErr != nil {
+		return nil, fmt.Errorf("cannot read response body: %w", readErr)
+	}
+	status := new(ReindexStatus)
+	err = json.Unmarshal(body, status)
+	if err != nil {
+		return nil, fmt.Errorf("cannot unmarshal response body: %s", err)
+	}
+	return status, nil
+}
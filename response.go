@@ -0,0 +1,59 @@
+/*
+  Source Configuration Service
+  © 2022 Southwinds Tech Ltd - www.southwinds.io
+  Licensed under the Apache License, Version 2.0 at http://www.apache.org/licenses/LICENSE-2.0
+  Contributors to this project, hereby assign copyright in this code to the project,
+  to be licensed under the same terms as the rest of the code.
+*/
+
+package src
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// defaultMaxResponseBytes the maximum size of a response body if not specified in the client options
+const defaultMaxResponseBytes = 100 << 20
+
+// readBody reads and closes the response body, inflating it if the server compressed it
+// returns a *ResponseTooLargeError if the (inflated) body exceeds MaxResponseBytes
+func (c *Client) readBody(resp *http.Response) ([]byte, error) {
+	defer resp.Body.Close()
+	var reader io.Reader = resp.Body
+	if strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		gzipReader, err := gzip.NewReader(resp.Body)
+		if err == io.EOF {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	}
+	limit := c.maxResponseBytes()
+	// reads one more byte than allowed to tell a body of exactly the limit from a larger one
+	body, err := io.ReadAll(io.LimitReader(reader, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > limit {
+		tooLarge := &ResponseTooLargeError{Limit: limit}
+		if resp.Request != nil {
+			tooLarge.Method, tooLarge.Path = resp.Request.Method, resp.Request.URL.Path
+		}
+		return nil, tooLarge
+	}
+	return body, nil
+}
+
+// maxResponseBytes the maximum size of a response body
+func (c *Client) maxResponseBytes() int64 {
+	if c.opts.MaxResponseBytes <= 0 {
+		return defaultMaxResponseBytes
+	}
+	return c.opts.MaxResponseBytes
+}
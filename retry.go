@@ -0,0 +1,287 @@
+/*
+  Source Configuration Service
+  © 2022 Southwinds Tech Ltd - www.southwinds.io
+  Licensed under the Apache License, Version 2.0 at http://www.apache.org/licenses/LICENSE-2.0
+  Contributors to this project, hereby assign copyright in this code to the project,
+  to be licensed under the same terms as the rest of the code.
+*/
+
+package src
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/hashicorp/go-retryablehttp"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RetryPolicy controls how the client waits between retry attempts
+// zero values fall back to the retryablehttp defaults
+type RetryPolicy struct {
+	// MinWait the minimum time to wait before retrying
+	MinWait time.Duration
+	// MaxWait the maximum time to wait before retrying
+	MaxWait time.Duration
+	// Jitter the fraction (0 to 1) of the computed wait that is randomly added or subtracted
+	Jitter float64
+	// MaxElapsedTime the ceiling on the total time a call can take including all its retries (0 = no limit)
+	// unlike Timeout which applies to each attempt, this bounds the whole call, cutting off the attempt in flight
+	MaxElapsedTime time.Duration
+	// BudgetPerSecond caps the retries per second made by all the calls of a client (0 = no limit)
+	// once the budget is used up, failed attempts are not retried until it refills, so that
+	// many calls failing at once do not flood a struggling server with retries
+	BudgetPerSecond float64
+	// BudgetBurst the number of retries that can be made at once before the budget is capped, defaults to BudgetPerSecond
+	// and is at least 1
+	BudgetBurst int
+}
+
+// OnRetryFunc is invoked before a failed attempt is retried
+// attempt: the 1-based number of the attempt that failed
+// resp: the response of the failed attempt, nil if the request could not be made
+// err: the transport error of the failed attempt, if any
+type OnRetryFunc func(attempt int, resp *http.Response, err error)
+
+type retryStateKey struct{}
+
+// retryState keeps track of the attempts made by a single call
+type retryState struct {
+	clock    Clock
+	start    time.Time
+	attempts int
+	// lastErr the error of the last attempt if it failed with a transient error
+	lastErr error
+}
+
+// exhaustedError the *RetriesExhaustedError of the request wrapping the error of the last failed attempt
+func (s *retryState) exhaustedError(request *http.Request, err error) error {
+	if s.lastErr != nil {
+		err = s.lastErr
+	}
+	return &RetriesExhaustedError{
+		Method:   requestMethod(request),
+		Path:     request.URL.Path,
+		Attempts: s.attempts,
+		Elapsed:  s.clock.Now().Sub(s.start),
+		Err:      err,
+	}
+}
+
+func withRetryState(ctx context.Context, clock Clock) (context.Context, *retryState) {
+	state := &retryState{clock: clock, start: clock.Now()}
+	return context.WithValue(ctx, retryStateKey{}, state), state
+}
+
+func retryStateFrom(ctx context.Context) *retryState {
+	state, _ := ctx.Value(retryStateKey{}).(*retryState)
+	return state
+}
+
+// checkRetry wraps the default retry policy to enforce the elapsed time limit and notify retries
+func (c *Client) checkRetry(ctx context.Context, resp *http.Response, err error) (bool, error) {
+	retry, checkErr := retryablehttp.DefaultRetryPolicy(ctx, resp, err)
+	// retrying with the same credentials cannot succeed
+	if resp != nil && (resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden) {
+		retry = false
+	}
+	state := retryStateFrom(ctx)
+	if state == nil {
+		return retry, checkErr
+	}
+	state.attempts++
+	// keep the cause of the transient failure rather than the cancellation of the call
+	if ctx.Err() == nil {
+		state.lastErr = nil
+		if retry && err != nil {
+			state.lastErr = err
+		} else if retry {
+			state.lastErr = statusError(resp, "")
+		}
+	}
+	if !retry {
+		return retry, checkErr
+	}
+	// only spends the budget if retryablehttp is going to make another attempt
+	if c.budget != nil && state.attempts <= c.RetryMax && !c.budget.take() {
+		if logger, ok := c.Logger.(retryablehttp.Logger); ok {
+			logger.Printf("[DEBUG] retry budget exhausted, not retrying")
+		}
+		return false, checkErr
+	}
+	// only notify if retryablehttp is going to make another attempt
+	if c.opts.OnRetry != nil && state.attempts <= c.RetryMax {
+		c.opts.OnRetry(state.attempts, resp, err)
+	}
+	return retry, checkErr
+}
+
+// backoff computes the exponential wait and applies the configured jitter
+func (c *Client) backoff(min, max time.Duration, attemptNum int, resp *http.Response) time.Duration {
+	return jittered(retryablehttp.DefaultBackoff(min, max, attemptNum, resp), c.opts.RetryPolicy.Jitter)
+}
+
+// jittered randomly adds or subtracts the jitter fraction of the wait
+func jittered(wait time.Duration, jitter float64) time.Duration {
+	if jitter <= 0 {
+		return wait
+	}
+	if jitter > 1 {
+		jitter = 1
+	}
+	delta := float64(wait) * jitter
+	return time.Duration(float64(wait) - delta + rand.Float64()*2*delta)
+}
+
+const (
+	// defaultRetryMinWait the minimum wait of Retry if not specified by the policy, as in retryablehttp
+	defaultRetryMinWait = time.Second
+	// defaultRetryMaxWait the maximum wait of Retry if not specified by the policy, as in retryablehttp
+	defaultRetryMaxWait = 30 * time.Second
+	// maxRetryAttempts the number of attempts Retry makes at most, as many as the client makes per call
+	maxRetryAttempts = 21
+)
+
+// IsTransient true if the error might not happen again if the operation is retried, as classified by the
+// client to retry calls: connection errors and the server failing with a 5xx or 429 status, including calls that
+// failed with them after exhausting their retries; cancellations, credentials rejected and other errors are not transient
+func IsTransient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var authErr *AuthError
+	if errors.As(err, &authErr) {
+		return false
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500 || statusErr.StatusCode == http.StatusTooManyRequests
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	// the client only retries calls failing with transient errors
+	var exhausted *RetriesExhaustedError
+	return errors.As(err, &exhausted)
+}
+
+// Retry calls fn until it succeeds or fails with an error that is not transient, see IsTransient, e.g. to retry
+// a load-modify-save as a unit; it waits between attempts as the policy sets and as the client waits between
+// the attempts of a call, up to 21 attempts or MaxElapsedTime, returning the last error
+// the retry budget of the policy is not applied; if the context is done first, the error returned matches the
+// context error, e.g. using errors.Is(err, context.DeadlineExceeded), and wraps the last error
+func Retry(ctx context.Context, policy RetryPolicy, fn func() error) error {
+	return retryWith(ctx, realClock{}, policy, fn)
+}
+
+// retryWith the Retry of fn waiting between attempts as measured by the clock
+func retryWith(ctx context.Context, clock Clock, policy RetryPolicy, fn func() error) error {
+	minWait, maxWait := policy.MinWait, policy.MaxWait
+	if minWait <= 0 {
+		minWait = defaultRetryMinWait
+	}
+	if maxWait <= 0 {
+		maxWait = defaultRetryMaxWait
+	}
+	start := clock.Now()
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || !IsTransient(err) || attempt+1 >= maxRetryAttempts {
+			return err
+		}
+		if policy.MaxElapsedTime > 0 && clock.Now().Sub(start) >= policy.MaxElapsedTime {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return &abandonedError{ctxErr: ctx.Err(), err: err}
+		case <-clock.After(jittered(retryablehttp.DefaultBackoff(minWait, maxWait, attempt, nil), policy.Jitter)):
+		}
+	}
+}
+
+// abandonedError the last error of an operation abandoned because its context is done, matching the context error
+type abandonedError struct {
+	ctxErr error
+	err    error
+}
+
+func (e *abandonedError) Error() string {
+	return fmt.Sprintf("%s: %s", e.ctxErr, e.err)
+}
+
+func (e *abandonedError) Unwrap() error {
+	return e.err
+}
+
+func (e *abandonedError) Is(target error) bool {
+	return target == e.ctxErr
+}
+
+// cancelReadCloser releases the call context once the response body has been consumed
+type cancelReadCloser struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (r *cancelReadCloser) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if err != nil {
+		r.cancel()
+	}
+	return n, err
+}
+
+func (r *cancelReadCloser) Close() error {
+	r.cancel()
+	return r.ReadCloser.Close()
+}
+
+// retryBudget a token bucket limiting the retries made by a client
+type retryBudget struct {
+	lock   sync.Mutex
+	clock  Clock
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newRetryBudget creates the retry budget of the policy, nil if the retries are not limited
+func newRetryBudget(policy RetryPolicy, clock Clock) *retryBudget {
+	if policy.BudgetPerSecond <= 0 {
+		return nil
+	}
+	burst := float64(policy.BudgetBurst)
+	if burst <= 0 {
+		burst = policy.BudgetPerSecond
+	}
+	// a fractional rate still allows a retry at once, otherwise no retry could ever be taken
+	if burst < 1 {
+		burst = 1
+	}
+	return &retryBudget{clock: clock, rate: policy.BudgetPerSecond, burst: burst, tokens: burst, last: clock.Now()}
+}
+
+// take spends a retry if there is one left in the budget
+func (b *retryBudget) take() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	now := b.clock.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
@@ -0,0 +1,104 @@
+/*
+  Source Configuration Service
+  © 2022 Southwinds Tech Ltd - www.southwinds.io
+  Licensed under the Apache License, Version 2.0 at http://www.apache.org/licenses/LICENSE-2.0
+  Contributors to this project, hereby assign copyright in this code to the project,
+  to be licensed under the same terms as the rest of the code.
+*/
+
+package src
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// defaultSchemaCacheTTL the time a type schema is cached for if not specified in the client options
+const defaultSchemaCacheTTL = 5 * time.Minute
+
+// schemaCache caches the json schemas of item types keyed by item type
+// concurrent requests for a schema not in the cache are collapsed into a single fetch
+type schemaCache struct {
+	lock    sync.Mutex
+	entries map[string]*schemaEntry
+}
+
+// schemaEntry a cached schema, or a fetch in progress if done is open
+type schemaEntry struct {
+	done    chan struct{}
+	schema  json.RawMessage
+	err     error
+	expires time.Time
+}
+
+func newSchemaCache() *schemaCache {
+	return &schemaCache{entries: map[string]*schemaEntry{}}
+}
+
+// get returns the cached schema or fetches it, waiting for a fetch already in progress if there is one
+func (s *schemaCache) get(itemType string, ttl time.Duration, clock Clock, fetch func() (json.RawMessage, error)) (json.RawMessage, error) {
+	s.lock.Lock()
+	entry, ok := s.entries[itemType]
+	if ok {
+		select {
+		case <-entry.done:
+			// the fetch has completed, uses it unless expired or failed
+			if entry.err == nil && clock.Now().Before(entry.expires) {
+				s.lock.Unlock()
+				return entry.schema, nil
+			}
+		default:
+			// a fetch is in progress, waits for it
+			s.lock.Unlock()
+			<-entry.done
+			return entry.schema, entry.err
+		}
+	}
+	entry = &schemaEntry{done: make(chan struct{})}
+	s.entries[itemType] = entry
+	s.lock.Unlock()
+	entry.schema, entry.err = fetch()
+	entry.expires = clock.Now().Add(ttl)
+	close(entry.done)
+	return entry.schema, entry.err
+}
+
+func (s *schemaCache) invalidate(itemType string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.entries, itemType)
+}
+
+// schema the json schema of the specified item type, served from the cache if not expired
+func (c *Client) schema(itemType string) (json.RawMessage, error) {
+	ttl := c.opts.SchemaCacheTTL
+	if ttl <= 0 {
+		ttl = defaultSchemaCacheTTL
+	}
+	return c.schemas.get(itemType, ttl, c.opts.Clock, func() (json.RawMessage, error) {
+		t, err := c.GetType(itemType)
+		if err != nil {
+			return nil, err
+		}
+		return t.Schema, nil
+	})
+}
+
+// InvalidateSchema removes the schema of the specified item type from the cache
+// so that it is fetched again the next time it is needed, e.g. after the type was updated by another client
+// types updated using SetType are invalidated automatically
+func (c *Client) InvalidateSchema(itemType string) {
+	c.schemas.invalidate(itemType)
+}
+
+// GetItemSchema the json schema the item is validated against, i.e. the schema of the item type
+// e.g. to show the rule that caused a Save to be rejected; the schema is served from the schema cache
+// returns ErrNotFound if the item or its type does not exist
+func (c *Client) GetItemSchema(itemKey string) (json.RawMessage, error) {
+	item, err := c.LoadRaw(itemKey)
+	if err != nil {
+		return nil, err
+	}
+	return c.schema(item.Type)
+}
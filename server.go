@@ -0,0 +1,116 @@
+/*
+  Source Configuration Service
+  © 2022 Southwinds Tech Ltd - www.southwinds.io
+  Licensed under the Apache License, Version 2.0 at http://www.apache.org/licenses/LICENSE-2.0
+  Contributors to this project, hereby assign copyright in this code to the project,
+  to be licensed under the same terms as the rest of the code.
+*/
+
+package src
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hashicorp/go-retryablehttp"
+	"net/http"
+	"sync"
+)
+
+// the features a source server can report in its ServerInfo
+const (
+	// FeatureTransactions the server commits transactions atomically, see Tx
+	FeatureTransactions = "transactions"
+	// FeatureReindex the server rebuilds its derived data on request, see Reindex
+	FeatureReindex = "reindex"
+	// FeatureTagQuery the server evaluates tag queries, see LoadItemsByTagQuery
+	FeatureTagQuery = "tag-query"
+)
+
+// ServerInfo the version and capabilities of the source server
+type ServerInfo struct {
+	// Version the version of the source server
+	Version string `json:"version"`
+	// Features the optional features the server offers, e.g. FeatureTransactions
+	Features []string `json:"features"`
+}
+
+// Supports true if the server offers the feature
+func (i *ServerInfo) Supports(feature string) bool {
+	for _, f := range i.Features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// serverInfoCache the server info retrieved once for the lifetime of the client
+type serverInfoCache struct {
+	lock sync.Mutex
+	info *ServerInfo
+	// unsupported true if the server does not report its info
+	unsupported bool
+}
+
+// ServerInfo the version and features of the source server, e.g. to check compatibility before using newer features
+// it is retrieved on first use and cached for the lifetime of the client
+// returns ErrUnsupported if the server predates reporting its version
+func (c *Client) ServerInfo() (*ServerInfo, error) {
+	c.info.lock.Lock()
+	defer c.info.lock.Unlock()
+	if c.info.info != nil {
+		return c.info.info, nil
+	}
+	if c.info.unsupported {
+		return nil, ErrUnsupported
+	}
+	request, err := retryablehttp.NewRequest(http.MethodGet, c.url("/info"), nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Authorization", c.token)
+	request.Header.Set("User-Agent", UserAgent)
+	resp, reqErr := c.do(request)
+	if reqErr != nil {
+		return nil, reqErr
+	}
+	defer resp.Body.Close()
+	if unsupported(resp.StatusCode) {
+		c.info.unsupported = true
+		return nil, ErrUnsupported
+	}
+	if resp.StatusCode > 299 {
+		return nil, statusError(resp, "cannot get server info")
+	}
+	body, readErr := c.readBody(resp)
+	if readErr != nil {
+		return nil, fmt.Errorf("cannot read response body: %w", readErr)
+	}
+	if len(body) == 0 {
+		return nil, &EmptyResponseError{Method: http.MethodGet, Path: request.URL.Path, Status: resp.Status}
+	}
+	info := new(ServerInfo)
+	if err = json.Unmarshal(body, info); err != nil {
+		return nil, fmt.Errorf("cannot unmarshal response body: %s", err)
+	}
+	c.info.info = info
+	return info, nil
+}
+
+// requireFeature returns ErrUnsupported if the server reports its features and the feature is not one of them
+// if the features are unknown the feature is assumed to be offered, leaving the call itself to find out
+func (c *Client) requireFeature(feature string) error {
+	info, err := c.ServerInfo()
+	if err != nil {
+		var authErr *AuthError
+		if errors.As(err, &authErr) {
+			return err
+		}
+		return nil
+	}
+	if info.Features != nil && !info.Supports(feature) {
+		return fmt.Errorf("%w: source server version %s does not offer %s", ErrUnsupported, info.Version, feature)
+	}
+	return nil
+}
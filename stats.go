@@ -0,0 +1,182 @@
+/*
+  Source Configuration Service
+  © 2022 Southwinds Tech Ltd - www.southwinds.io
+  Licensed under the Apache License, Version 2.0 at http://www.apache.org/licenses/LICENSE-2.0
+  Contributors to this project, hereby assign copyright in this code to the project,
+  to be licensed under the same terms as the rest of the code.
+*/
+
+package src
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/hashicorp/go-retryablehttp"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// CallStats describes a completed call to the source server
+type CallStats struct {
+	// Method the http method of the call
+	Method string
+	// Path the path of the call without the host
+	Path string
+	// Attempts the number of attempts made, including retries
+	Attempts int
+	// Duration the time taken by the call including all its retries
+	Duration time.Duration
+	// StatusCode the status code of the last response, 0 if no response was received
+	StatusCode int
+	// Err the error of the call if it could not complete
+	Err error
+	// RequestBytes the size of the request body, 0 if there is none
+	RequestBytes int64
+	// ResponseBytes the size of the response body as received, -1 if unknown
+	// it is counted as the body is read, without buffering it, so a body closed well before its end has the size
+	// declared by the server, if any
+	ResponseBytes int64
+}
+
+// CallHook receives the stats of every call made by the client
+type CallHook func(stats CallStats)
+
+// BodyHook receives the request and response bodies of every call made by the client, e.g. for a compliance
+// audit trail; op is the method and path of the call, e.g. "PUT /item/APP_1", status is 0 if no response was
+// received; no headers are passed so the credentials of the client are never exposed
+type BodyHook func(op string, reqBody, respBody []byte, status int)
+
+// recordBodies passes the bodies of the call to the body hook, if set
+// bodies larger than MaxResponseBytes are passed truncated to it
+func (c *Client) recordBodies(request *retryablehttp.Request, resp *http.Response, err error, respBody []byte) {
+	hook := c.opts.OnBody
+	if hook == nil {
+		return
+	}
+	op := fmt.Sprintf("%s %s", requestMethod(request.Request), request.URL.Path)
+	reqBody, _ := request.BodyBytes()
+	if err != nil || resp == nil {
+		hook(op, reqBody, nil, 0)
+		return
+	}
+	if limit := c.maxResponseBytes(); int64(len(respBody)) > limit {
+		respBody = respBody[:limit]
+	}
+	hook(op, reqBody, respBody, resp.StatusCode)
+}
+
+// measure reports the call once its response body is closed, counting the body as the caller reads it so that
+// streaming it costs no memory; the body is buffered upfront only if the body hook needs it
+func (c *Client) measure(request *retryablehttp.Request, state *retryState, resp *http.Response, err error) {
+	if err != nil || resp == nil {
+		c.report(request, state, resp, err, -1)
+		c.recordBodies(request, resp, err, nil)
+		return
+	}
+	if c.opts.OnBody == nil {
+		resp.Body = &countingBody{ReadCloser: resp.Body, size: resp.ContentLength, done: func(size int64) {
+			c.report(request, state, resp, nil, size)
+		}}
+		return
+	}
+	// reads one more byte than allowed so that the caller still finds out the body is too large
+	respBody, readErr := io.ReadAll(io.LimitReader(resp.Body, c.maxResponseBytes()+1))
+	// the caller reads the buffered body followed by any remainder, or the read error
+	rest := io.Reader(resp.Body)
+	if readErr != nil {
+		rest = &errorReader{err: readErr}
+	}
+	resp.Body = &bufferedBody{Reader: io.MultiReader(bytes.NewReader(respBody), rest), Closer: resp.Body}
+	c.report(request, state, resp, nil, int64(len(respBody)))
+	c.recordBodies(request, resp, nil, respBody)
+}
+
+// maxDrainBytes the most bytes left unread in a response body that are discarded on close to measure it
+const maxDrainBytes = 64 << 10
+
+// countingBody a response body counting the bytes read from it, passing the size of the body to done once closed
+// a small remainder left unread is discarded to count it, otherwise the size is the one declared by the server,
+// -1 if none
+type countingBody struct {
+	io.ReadCloser
+	read int64
+	eof  bool
+	size int64
+	once sync.Once
+	done func(size int64)
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	if err == io.EOF {
+		b.eof = true
+	}
+	return n, err
+}
+
+func (b *countingBody) Close() error {
+	if !b.eof {
+		io.Copy(io.Discard, io.LimitReader(b, maxDrainBytes))
+	}
+	err := b.ReadCloser.Close()
+	b.once.Do(func() {
+		if b.eof {
+			b.size = b.read
+		}
+		b.done(b.size)
+	})
+	return err
+}
+
+// bufferedBody a response body read from a buffer, closing the original body
+type bufferedBody struct {
+	io.Reader
+	io.Closer
+}
+
+// errorReader fails every read with the error
+type errorReader struct {
+	err error
+}
+
+func (r *errorReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
+
+// LastCall the stats of the last call made by the client, nil if none, e.g. to inspect payload sizes while
+// debugging; with concurrent calls it is the last one to complete
+func (c *Client) LastCall() *CallStats {
+	return c.last.Load()
+}
+
+// report notifies the call hook and logs calls that needed retrying
+func (c *Client) report(request *retryablehttp.Request, state *retryState, resp *http.Response, err error, respBytes int64) {
+	stats := CallStats{
+		Method:        requestMethod(request.Request),
+		Path:          request.URL.Path,
+		Attempts:      state.attempts,
+		Duration:      state.clock.Now().Sub(state.start),
+		Err:           err,
+		RequestBytes:  request.ContentLength,
+		ResponseBytes: respBytes,
+	}
+	if resp != nil {
+		stats.StatusCode = resp.StatusCode
+	}
+	c.last.Store(&stats)
+	if c.opts.OnCall != nil {
+		c.opts.OnCall(stats)
+	}
+	if stats.Attempts > 1 {
+		if logger, ok := c.Logger.(retryablehttp.Logger); ok {
+			if err != nil {
+				logger.Printf("[DEBUG] %s %s failed after %d attempts: %s", stats.Method, stats.Path, stats.Attempts, err)
+			} else {
+				logger.Printf("[DEBUG] %s %s completed after %d attempts", stats.Method, stats.Path, stats.Attempts)
+			}
+		}
+	}
+}
@@ -0,0 +1,73 @@
+/*
+  Source Configuration Service
+  © 2022 Southwinds Tech Ltd - www.southwinds.io
+  Licensed under the Apache License, Version 2.0 at http://www.apache.org/licenses/LICENSE-2.0
+  Contributors to this project, hereby assign copyright in this code to the project,
+  to be licensed under the same terms as the rest of the code.
+*/
+
+package src
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// defaultStreamThreshold the size above which values saved using SaveStream are streamed if not specified
+const defaultStreamThreshold = 8 << 20
+
+// SaveStream saves the serialized value read from r under the key, e.g. to upload large values
+// retrying a call requires sending its body again, so values up to ClientOptions.StreamThreshold are buffered in
+// memory and saved with the usual retries, while larger values are streamed in a single attempt without retries:
+// raise the threshold to retry larger values at the cost of memory, or lower it to save memory at the cost of
+// failing on transient errors; the value is not validated client-side
+func (c *Client) SaveStream(key, itemType string, r io.Reader) error {
+	if len(itemType) == 0 {
+		return fmt.Errorf("item type is required to validate the item data")
+	}
+	key = c.expandKey(key)
+	threshold := c.opts.StreamThreshold
+	if threshold == 0 {
+		threshold = defaultStreamThreshold
+	}
+	var head []byte
+	if threshold > 0 {
+		// reads one more byte than the threshold to tell whether the value exceeds it
+		var err error
+		if head, err = io.ReadAll(io.LimitReader(r, threshold+1)); err != nil {
+			return fmt.Errorf("cannot read item value: %s", err)
+		}
+		if int64(len(head)) <= threshold {
+			return c.saveRaw(key, itemType, head, nil)
+		}
+	}
+	return c.saveStreamed(key, itemType, io.MultiReader(bytes.NewReader(head), r))
+}
+
+// saveStreamed puts the value read from body in a single attempt, bypassing the retrying client which would
+// buffer the whole body to be able to resend it; the body is not passed to the OnBody hook
+func (c *Client) saveStreamed(key, itemType string, body io.Reader) error {
+	request, err := http.NewRequest(http.MethodPut, c.url("/item/%s", key), body)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", c.token)
+	request.Header.Set("User-Agent", UserAgent)
+	request.Header.Set(c.typeHeader(), itemType)
+	resp, err := c.doOnce(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode > 299 {
+		statusErr := statusError(resp, "cannot save item")
+		respBody, readErr := c.readBody(resp)
+		if readErr == nil && len(respBody) > 0 {
+			statusErr.Message = string(respBody)
+		}
+		return statusErr
+	}
+	return nil
+}
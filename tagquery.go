@@ -0,0 +1,256 @@
+/*
+  Source Configuration Service
+  © 2022 Southwinds Tech Ltd - www.southwinds.io
+  Licensed under the Apache License, Version 2.0 at http://www.apache.org/licenses/LICENSE-2.0
+  Contributors to this project, hereby assign copyright in this code to the project,
+  to be licensed under the same terms as the rest of the code.
+*/
+
+package src
+
+import (
+	"fmt"
+	"github.com/hashicorp/go-retryablehttp"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode"
+)
+
+// TagQuery a boolean expression over item tags, e.g. (env=prod OR env=staging) AND tier=db
+// build it using HasTagValue, HasTagName, And and Or, or parse it from text using ParseTagQuery
+type TagQuery struct {
+	// op one of "and", "or" or "" for a tag match
+	op    string
+	terms []TagQuery
+	name  string
+	value string
+	// anyValue true if the match only requires the tag to exist
+	anyValue bool
+}
+
+// HasTagValue matches the items having the tag with the specified value
+func HasTagValue(name, value string) TagQuery {
+	return TagQuery{name: name, value: value}
+}
+
+// HasTagName matches the items having the tag whatever its value
+func HasTagName(name string) TagQuery {
+	return TagQuery{name: name, anyValue: true}
+}
+
+// And matches the items matching all the queries
+func And(queries ...TagQuery) TagQuery {
+	return TagQuery{op: "and", terms: queries}
+}
+
+// Or matches the items matching any of the queries
+func Or(queries ...TagQuery) TagQuery {
+	return TagQuery{op: "or", terms: queries}
+}
+
+// Validate checks the query is well-formed
+func (q TagQuery) Validate() error {
+	if len(q.op) > 0 {
+		if len(q.terms) == 0 {
+			return fmt.Errorf("invalid tag query: %s requires at least one term", strings.ToUpper(q.op))
+		}
+		for _, term := range q.terms {
+			if err := term.Validate(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if len(q.name) == 0 {
+		return fmt.Errorf("invalid tag query: a tag name is required")
+	}
+	if strings.ContainsAny(q.name, "=() \t\r\n") || strings.ContainsAny(q.value, "() \t\r\n") {
+		return fmt.Errorf("invalid tag query: tag '%s=%s' contains reserved characters", q.name, q.value)
+	}
+	return nil
+}
+
+// String the query in the text form sent to the source server, e.g. (env=prod OR env=staging) AND tier=db
+func (q TagQuery) String() string {
+	if len(q.op) == 0 {
+		if q.anyValue {
+			return q.name
+		}
+		return fmt.Sprintf("%s=%s", q.name, q.value)
+	}
+	terms := make([]string, len(q.terms))
+	for i, term := range q.terms {
+		terms[i] = term.String()
+		// nested groups are enclosed in parentheses so the precedence of the operators is explicit
+		if len(term.op) > 0 && term.op != q.op && len(term.terms) > 1 {
+			terms[i] = "(" + terms[i] + ")"
+		}
+	}
+	return strings.Join(terms, " "+strings.ToUpper(q.op)+" ")
+}
+
+// ParseTagQuery parses a query such as (env=prod OR env=staging) AND tier=db
+// terms are tag matches in the form name=value, or name to match any value, combined using AND and OR
+// AND binds tighter than OR and parentheses can be used for grouping; the operators are case-insensitive
+func ParseTagQuery(query string) (TagQuery, error) {
+	p := &tagQueryParser{tokens: tagQueryTokens(query)}
+	if len(p.tokens) == 0 {
+		return TagQuery{}, fmt.Errorf("invalid tag query: the query is empty")
+	}
+	q, err := p.parseOr()
+	if err != nil {
+		return TagQuery{}, fmt.Errorf("invalid tag query '%s': %s", query, err)
+	}
+	if p.pos < len(p.tokens) {
+		return TagQuery{}, fmt.Errorf("invalid tag query '%s': unexpected '%s'", query, p.tokens[p.pos])
+	}
+	return q, q.Validate()
+}
+
+// tagQueryTokens splits a tag query into parentheses and words
+func tagQueryTokens(query string) []string {
+	var tokens []string
+	var word strings.Builder
+	flush := func() {
+		if word.Len() > 0 {
+			tokens = append(tokens, word.String())
+			word.Reset()
+		}
+	}
+	for _, r := range query {
+		switch {
+		case r == '(' || r == ')':
+			flush()
+			tokens = append(tokens, string(r))
+		case unicode.IsSpace(r):
+			flush()
+		default:
+			word.WriteRune(r)
+		}
+	}
+	flush()
+	return tokens
+}
+
+// tagQueryParser a recursive descent parser of tag queries
+type tagQueryParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *tagQueryParser) next() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *tagQueryParser) parseOr() (TagQuery, error) {
+	return p.parseList("or", p.parseAnd)
+}
+
+func (p *tagQueryParser) parseAnd() (TagQuery, error) {
+	return p.parseList("and", p.parseTerm)
+}
+
+// parseList parses terms separated by the operator, returning the single term if there is no operator
+func (p *tagQueryParser) parseList(op string, parse func() (TagQuery, error)) (TagQuery, error) {
+	term, err := parse()
+	if err != nil {
+		return TagQuery{}, err
+	}
+	terms := []TagQuery{term}
+	for strings.EqualFold(p.next(), op) {
+		p.pos++
+		if term, err = parse(); err != nil {
+			return TagQuery{}, err
+		}
+		terms = append(terms, term)
+	}
+	if len(terms) == 1 {
+		return terms[0], nil
+	}
+	return TagQuery{op: op, terms: terms}, nil
+}
+
+func (p *tagQueryParser) parseTerm() (TagQuery, error) {
+	token := p.next()
+	switch {
+	case len(token) == 0:
+		return TagQuery{}, fmt.Errorf("unexpected end of query")
+	case token == "(":
+		p.pos++
+		q, err := p.parseOr()
+		if err != nil {
+			return TagQuery{}, err
+		}
+		if p.next() != ")" {
+			return TagQuery{}, fmt.Errorf("missing ')'")
+		}
+		p.pos++
+		return q, nil
+	case token == ")" || strings.EqualFold(token, "and") || strings.EqualFold(token, "or"):
+		return TagQuery{}, fmt.Errorf("unexpected '%s'", token)
+	}
+	p.pos++
+	name, value, hasValue := strings.Cut(token, "=")
+	if len(name) == 0 {
+		return TagQuery{}, fmt.Errorf("missing tag name in '%s'", token)
+	}
+	if !hasValue {
+		return HasTagName(name), nil
+	}
+	return HasTagValue(name, value), nil
+}
+
+// LoadItemsByTagQueryRaw the items whose tags match the query
+// returns ErrUnsupported if the source server does not support tag queries
+func (c *Client) LoadItemsByTagQueryRaw(query TagQuery) (IL, error) {
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+	if err := c.requireFeature(FeatureTagQuery); err != nil {
+		return nil, err
+	}
+	request, err := retryablehttp.NewRequest(http.MethodGet, c.listURL(url.Values{"query": []string{query.String()}}, "/item/tag"), nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Authorization", c.token)
+	request.Header.Set("User-Agent", UserAgent)
+	c.setListHeaders(request)
+	resp, reqErr := c.do(request)
+	if reqErr != nil {
+		return nil, reqErr
+	}
+	defer resp.Body.Close()
+	if unsupported(resp.StatusCode) {
+		return nil, ErrUnsupported
+	}
+	if resp.StatusCode > 299 {
+		return nil, statusError(resp, "cannot get items matching tag query")
+	}
+	body, readErr := c.readBody(resp)
+	if readErr != nil {
+		return nil, fmt.Errorf("cannot read response body: %w", readErr)
+	}
+	if len(body) == 0 {
+		return nil, nil
+	}
+	var items IL
+	err = c.opts.Codec.Unmarshal(body, &items)
+	if err != nil {
+		return nil, fmt.Errorf("cannot unmarshal response body: %s", err)
+	}
+	return c.listed(items)
+}
+
+// LoadItemsByTagQuery the items whose tags match the query, converted using the factory
+func (c *Client) LoadItemsByTagQuery(factory func() any, query TagQuery) ([]any, error) {
+	items, err := c.LoadItemsByTagQueryRaw(query)
+	if err != nil {
+		return nil, err
+	}
+	return c.typed(items, factory)
+}
@@ -0,0 +1,66 @@
+/*
+  Source Configuration Service
+  © 2022 Southwinds Tech Ltd - www.southwinds.io
+  Licensed under the Apache License, Version 2.0 at http://www.apache.org/licenses/LICENSE-2.0
+  Contributors to this project, hereby assign copyright in this code to the project,
+  to be licensed under the same terms as the rest of the code.
+*/
+
+package src
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"text/template"
+)
+
+// SaveTemplate expands the template stored in the item templateKey using vars, validates the result against
+// the schema of itemType and saves it under key, e.g. to generate the configuration of each environment from a base
+// the template is the value of the template item, or its content if the value is a json string, written using
+// Go text/template; the expansion must be json, so use the json function to insert values safely, e.g.
+// {"host": {{ json .host }}, "port": {{ .port }}}; variables missing from vars fail the expansion
+func (c *Client) SaveTemplate(key, itemType, templateKey string, vars map[string]any) error {
+	if len(itemType) == 0 {
+		return fmt.Errorf("item type is required to validate the expanded template")
+	}
+	key = c.expandKey(key)
+	templateItem, err := c.LoadRaw(templateKey)
+	if err != nil {
+		return err
+	}
+	text := string(templateItem.Value)
+	var content string
+	if json.Unmarshal(templateItem.Value, &content) == nil {
+		text = content
+	}
+	tmpl, err := template.New(templateKey).
+		Option("missingkey=error").
+		Funcs(template.FuncMap{"json": templateJSON}).
+		Parse(text)
+	if err != nil {
+		return fmt.Errorf("cannot parse template '%s': %s", templateKey, err)
+	}
+	var expanded bytes.Buffer
+	if err = tmpl.Execute(&expanded, vars); err != nil {
+		return fmt.Errorf("cannot expand template '%s': %s", templateKey, err)
+	}
+	var value any
+	if err = defaultCodec.Unmarshal(expanded.Bytes(), &value); err != nil {
+		return fmt.Errorf("template '%s' did not expand to valid json: %s", templateKey, err)
+	}
+	if err = c.ValidateAgainstType(itemType, value); err != nil {
+		return err
+	}
+	valueBytes, err := c.opts.Codec.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return c.saveRaw(key, itemType, valueBytes, nil)
+}
+
+// templateJSON marshals a template value as json
+func templateJSON(v any) (string, error) {
+	data, err := json.Marshal(v)
+	return string(data), err
+}
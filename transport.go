@@ -0,0 +1,82 @@
+/*
+  Source Configuration Service
+  © 2022 Southwinds Tech Ltd - www.southwinds.io
+  Licensed under the Apache License, Version 2.0 at http://www.apache.org/licenses/LICENSE-2.0
+  Contributors to this project, hereby assign copyright in this code to the project,
+  to be licensed under the same terms as the rest of the code.
+*/
+
+package src
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"time"
+)
+
+const (
+	// defaultMaxIdleConns the maximum number of idle connections kept across all hosts
+	defaultMaxIdleConns = 100
+	// defaultMaxIdleConnsPerHost the maximum number of idle connections kept to the source server
+	// a client talks to a single host so it is much higher than the net/http default of 2
+	defaultMaxIdleConnsPerHost = 32
+	// defaultIdleConnTimeout the time an idle connection is kept before being closed
+	defaultIdleConnTimeout = 90 * time.Second
+	// maxRedirects the maximum number of redirects followed, as in net/http
+	maxRedirects = 10
+)
+
+// newTransport creates the http transport using the connection pool settings in the client options
+func newTransport(opts *ClientOptions) *http.Transport {
+	maxIdleConns := opts.MaxIdleConns
+	if maxIdleConns <= 0 {
+		maxIdleConns = defaultMaxIdleConns
+	}
+	maxIdleConnsPerHost := opts.MaxIdleConnsPerHost
+	if maxIdleConnsPerHost <= 0 {
+		maxIdleConnsPerHost = defaultMaxIdleConnsPerHost
+	}
+	idleConnTimeout := opts.IdleConnTimeout
+	if idleConnTimeout <= 0 {
+		idleConnTimeout = defaultIdleConnTimeout
+	}
+	transport := &http.Transport{
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: opts.InsecureSkipVerify,
+		},
+		MaxIdleConns:        maxIdleConns,
+		MaxIdleConnsPerHost: maxIdleConnsPerHost,
+		MaxConnsPerHost:     opts.MaxConnsPerHost,
+		IdleConnTimeout:     idleConnTimeout,
+		// a custom TLS configuration disables HTTP/2 unless explicitly requested
+		ForceAttemptHTTP2: !opts.DisableHTTP2,
+	}
+	if opts.DisableHTTP2 {
+		// an empty, non-nil map prevents the transport from negotiating HTTP/2
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	return transport
+}
+
+// checkRedirect the redirect policy set by the client options, nil to use the net/http policy
+func checkRedirect(opts *ClientOptions) func(req *http.Request, via []*http.Request) error {
+	if opts.DisableRedirects {
+		return func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	}
+	if !opts.RedirectAuthSameHost {
+		return nil
+	}
+	return func(req *http.Request, via []*http.Request) error {
+		if len(via) >= maxRedirects {
+			return errors.New("stopped after 10 redirects")
+		}
+		// net/http forwards the credentials to subdomains and other ports of the original host too
+		if req.URL.Scheme != via[0].URL.Scheme || req.URL.Host != via[0].URL.Host {
+			req.Header.Del("Authorization")
+		}
+		return nil
+	}
+}
@@ -0,0 +1,236 @@
+/*
+  Source Configuration Service
+  © 2022 Southwinds Tech Ltd - www.southwinds.io
+  Licensed under the Apache License, Version 2.0 at http://www.apache.org/licenses/LICENSE-2.0
+  Contributors to this project, hereby assign copyright in this code to the project,
+  to be licensed under the same terms as the rest of the code.
+*/
+
+package src
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hashicorp/go-retryablehttp"
+	"net/http"
+	"strings"
+)
+
+// Transaction collects a set of operations to be committed as a unit
+type Transaction struct {
+	client *Client
+	ops    []txOp
+}
+
+// txOp an operation in a transaction
+type txOp struct {
+	Op    string          `json:"op"`
+	Key   string          `json:"key,omitempty"`
+	Type  string          `json:"type,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Tag   string          `json:"tag,omitempty"`
+	To    string          `json:"to,omitempty"`
+}
+
+// Save adds saving the item to the transaction, see Client.Save
+func (tx *Transaction) Save(key, itemType string, item Valid) error {
+	key, value, err := tx.client.prepareSave(key, itemType, item)
+	if err != nil {
+		return err
+	}
+	tx.ops = append(tx.ops, txOp{Op: "save", Key: key, Type: itemType, Value: value})
+	return nil
+}
+
+// Delete adds deleting the item to the transaction
+func (tx *Transaction) Delete(key string) {
+	tx.ops = append(tx.ops, txOp{Op: "delete", Key: key})
+}
+
+// Tag adds tagging the item to the transaction
+func (tx *Transaction) Tag(itemKey, tagName, tagValue string) error {
+	if len(tagName) == 0 {
+		return fmt.Errorf("a tag name is required")
+	}
+	tx.ops = append(tx.ops, txOp{Op: "tag", Key: itemKey, Name: tagName, Tag: tagValue})
+	return nil
+}
+
+// Untag adds removing the tag from the item to the transaction
+func (tx *Transaction) Untag(itemKey, tagName string) error {
+	if len(tagName) == 0 {
+		return fmt.Errorf("a tag name is required")
+	}
+	tx.ops = append(tx.ops, txOp{Op: "untag", Key: itemKey, Name: tagName})
+	return nil
+}
+
+// Link adds linking the items to the transaction
+func (tx *Transaction) Link(fromKey, toKey string) {
+	tx.ops = append(tx.ops, txOp{Op: "link", Key: fromKey, To: toKey})
+}
+
+// Unlink adds unlinking the items to the transaction
+func (tx *Transaction) Unlink(fromKey, toKey string) {
+	tx.ops = append(tx.ops, txOp{Op: "unlink", Key: fromKey, To: toKey})
+}
+
+// Tx runs fn to collect a set of operations and commits them as a unit
+// nothing is sent to the source server if fn returns an error
+// the operations are committed atomically in a single request; if the server does not support transactions,
+// Tx fails with ErrUnsupported unless ClientOptions.BestEffortTx is set, in which case they are applied one by one
+// instead: if one fails, the operations already applied are reverted in reverse order; the revert is not
+// guaranteed to succeed, e.g. link attributes are not restored, and concurrent changes made by other clients
+// may be overwritten
+func (c *Client) Tx(fn func(tx *Transaction) error) error {
+	tx := &Transaction{client: c}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if len(tx.ops) == 0 {
+		return nil
+	}
+	if err := c.requireFeature(FeatureTransactions); err != nil {
+		if errors.Is(err, ErrUnsupported) {
+			return tx.unsupported(err)
+		}
+		return err
+	}
+	opsBytes, err := json.Marshal(tx.ops)
+	if err != nil {
+		return err
+	}
+	request, err := retryablehttp.NewRequest(http.MethodPost, c.url("/tx"), bytes.NewReader(opsBytes))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", c.token)
+	request.Header.Set("User-Agent", UserAgent)
+	request.Header.Set("Content-Type", "application/json")
+	resp, reqErr := c.do(request)
+	if reqErr != nil {
+		return reqErr
+	}
+	defer resp.Body.Close()
+	if notImplemented(resp.StatusCode) {
+		return tx.unsupported(fmt.Errorf("%w: the source server does not offer transactions", ErrUnsupported))
+	}
+	if resp.StatusCode > 299 {
+		statusErr := statusError(resp, "cannot commit transaction")
+		body, err := c.readBody(resp)
+		if err == nil && len(body) > 0 {
+			statusErr.Message = string(body)
+		}
+		return statusErr
+	}
+	return nil
+}
+
+// unsupported applies the operations one by one if the client allows it, otherwise returns err
+func (tx *Transaction) unsupported(err error) error {
+	if !tx.client.opts.BestEffortTx {
+		return err
+	}
+	return tx.applyBestEffort()
+}
+
+// applyBestEffort applies the operations one by one reverting them if any fails
+func (tx *Transaction) applyBestEffort() error {
+	var undo []func() error
+	for _, op := range tx.ops {
+		revert, err := tx.apply(op)
+		if err != nil {
+			var revertErrs []string
+			for i := len(undo) - 1; i >= 0; i-- {
+				if revertErr := undo[i](); revertErr != nil {
+					revertErrs = append(revertErrs, revertErr.Error())
+				}
+			}
+			if len(revertErrs) > 0 {
+				return fmt.Errorf("cannot apply transaction operation '%s %s': %s; rollback failed: %s", op.Op, op.Key, err, strings.Join(revertErrs, "; "))
+			}
+			return fmt.Errorf("cannot apply transaction operation '%s %s', transaction rolled back: %s", op.Op, op.Key, err)
+		}
+		undo = append(undo, revert)
+	}
+	return nil
+}
+
+// apply applies a single operation returning the function that reverts it
+func (tx *Transaction) apply(op txOp) (func() error, error) {
+	c := tx.client
+	switch op.Op {
+	case "save", "delete":
+		previous, err := c.LoadRaw(op.Key)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return nil, err
+		}
+		if op.Op == "save" {
+			err = c.saveRaw(op.Key, op.Type, op.Value, nil)
+		} else {
+			err = c.Delete(op.Key)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if previous == nil {
+			return func() error { return c.Delete(op.Key) }, nil
+		}
+		return func() error { return c.saveRaw(previous.Key, previous.Type, previous.Value, nil) }, nil
+	case "tag", "untag":
+		value, found, err := c.GetTagValue(op.Key, op.Name)
+		if err != nil {
+			return nil, err
+		}
+		if op.Op == "tag" {
+			err = c.Tag(op.Key, op.Name, op.Tag)
+		} else {
+			err = c.Untag(op.Key, op.Name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return func() error { return c.Untag(op.Key, op.Name) }, nil
+		}
+		return func() error { return c.Tag(op.Key, op.Name, value) }, nil
+	case "link", "unlink":
+		previous, err := c.findLink(op.Key, op.To)
+		if err != nil {
+			return nil, err
+		}
+		if op.Op == "link" {
+			err = c.Link(op.Key, op.To)
+		} else {
+			err = c.Unlink(op.Key, op.To)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if previous != nil {
+			return func() error { return c.LinkWithAttributes(op.Key, op.To, previous.Attributes) }, nil
+		}
+		if op.Op == "link" {
+			return func() error { return c.Unlink(op.Key, op.To) }, nil
+		}
+		return func() error { return nil }, nil
+	}
+	return nil, fmt.Errorf("unknown transaction operation '%s'", op.Op)
+}
+
+// findLink the link from an item to another, nil if they are not linked
+func (c *Client) findLink(fromKey, toKey string) (*L, error) {
+	links, err := c.GetLinks(fromKey)
+	if err != nil {
+		return nil, err
+	}
+	for i := range links {
+		if links[i].From == fromKey && links[i].To == toKey {
+			return &links[i], nil
+		}
+	}
+	return nil, nil
+}
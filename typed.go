@@ -0,0 +1,115 @@
+/*
+  Source Configuration Service
+  © 2022 Southwinds Tech Ltd - www.southwinds.io
+  Licensed under the Apache License, Version 2.0 at http://www.apache.org/licenses/LICENSE-2.0
+  Contributors to this project, hereby assign copyright in this code to the project,
+  to be licensed under the same terms as the rest of the code.
+*/
+
+package src
+
+import (
+	"errors"
+	"fmt"
+)
+
+// PopOldestTyped pops the oldest item of the specified type and unmarshals its value into a new T
+// returns (nil, nil) if there are no items of the type
+func PopOldestTyped[T any](c *Client, itemType string) (*T, error) {
+	return typedValue[T](c.PopOldestRaw(itemType))
+}
+
+// PopNewestTyped pops the newest item of the specified type and unmarshals its value into a new T
+// returns (nil, nil) if there are no items of the type
+func PopNewestTyped[T any](c *Client, itemType string) (*T, error) {
+	return typedValue[T](c.PopNewestRaw(itemType))
+}
+
+// LoadOrDefaultTyped the value of the configuration item identified by key unmarshalled into a T,
+// or def if the item does not exist; only failures other than the item not being found are returned as errors
+func LoadOrDefaultTyped[T any](c *Client, itemKey string, def T) (T, error) {
+	item, err := c.LoadRaw(itemKey)
+	if errors.Is(err, ErrNotFound) {
+		return def, nil
+	}
+	value, err := typedValue[T](item, err)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return *value, nil
+}
+
+// typedValue unmarshals the value of the item into a new T, nil if there is no item
+func typedValue[T any](item *I, err error) (*T, error) {
+	if err != nil || item == nil {
+		return nil, err
+	}
+	value := new(T)
+	if err = item.unmarshal(value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// TypedClient a type-safe facade over a client for stores, or parts of them, dedicated to a single item type
+// values are saved and loaded as T without passing the item type or prototypes around
+type TypedClient[T any] struct {
+	client   *Client
+	itemType string
+}
+
+// NewTypedClient creates a typed client for the item type, registering the type with the json schema of T
+func NewTypedClient[T any](c *Client, itemType string) (*TypedClient[T], error) {
+	if len(itemType) == 0 {
+		return nil, fmt.Errorf("item type is required to create a typed client")
+	}
+	var zero T
+	if err := c.SetType(itemType, zero); err != nil {
+		return nil, err
+	}
+	return &TypedClient[T]{client: c, itemType: itemType}, nil
+}
+
+// Save the value under the key, see Client.Save; the value is validated first if T implements Valid
+func (t *TypedClient[T]) Save(key string, v T) error {
+	if valid, ok := any(v).(Valid); ok {
+		return t.client.Save(key, t.itemType, valid)
+	}
+	key = t.client.expandKey(key)
+	value, err := t.client.opts.Codec.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return t.client.saveRaw(key, t.itemType, value, nil)
+}
+
+// Load the value of the item identified by key
+func (t *TypedClient[T]) Load(key string) (*T, error) {
+	return typedValue[T](t.client.LoadRaw(key))
+}
+
+// List the values of all the items of the type, see Client.LoadAllByType
+func (t *TypedClient[T]) List() ([]T, error) {
+	items, err := t.client.LoadAllByType(t.itemType)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]T, len(items))
+	for i := range items {
+		if err = items[i].unmarshal(&values[i]); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// PopOldest removes and returns the value of the oldest item of the type, nil if there are none
+func (t *TypedClient[T]) PopOldest() (*T, error) {
+	return PopOldestTyped[T](t.client, t.itemType)
+}
+
+// PopNewest removes and returns the value of the newest item of the type, nil if there are none
+func (t *TypedClient[T]) PopNewest() (*T, error) {
+	return PopNewestTyped[T](t.client, t.itemType)
+}
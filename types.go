@@ -9,9 +9,13 @@
 package src
 
 import (
-	"encoding/json"
 	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
 	"reflect"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -25,14 +29,53 @@ type I struct {
 	Type    string    `json:"type"`
 	Value   []byte    `json:"value"`
 	Updated time.Time `json:"updated"`
+	// Version an opaque identifier of the item revision, used for conditional operations
+	Version string `json:"version,omitempty"`
+	// ETag the entity tag the server sent with the item, if any, see ETag.StrongMatch
+	ETag *ETag `json:"-"`
+	// Author who made the last change to the item, if recorded using SaveWithMeta
+	Author string `json:"author,omitempty"`
+	// Reason why the last change to the item was made, if recorded using SaveWithMeta
+	Reason string `json:"reason,omitempty"`
+	// ContentType the media type of the value, empty for the default application/json
+	ContentType string `json:"contentType,omitempty"`
+	// Encoding the encoding the value is stored with, e.g. gzip if saved using CompressValues
+	// the client inflates the values it loads, so it is only set on items listed without their value
+	Encoding string `json:"encoding,omitempty"`
+	// Deleted true if the item has been soft-deleted, only returned when reading with IncludeDeleted
+	Deleted bool `json:"deleted,omitempty"`
+	// DeletedAt the time the item was soft-deleted, nil if it has not been
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+	// codec the codec of the client that retrieved the item
+	codec Codec
 }
 
 func (i *I) Typed(item any) (result any, err error) {
-	err = json.Unmarshal(i.Value, item)
+	err = i.unmarshal(item)
 	result = item
 	return
 }
 
+// IsJSON true if the value of the item is json, i.e. it has no content type or a json media type
+func (i *I) IsJSON() bool {
+	if len(i.ContentType) == 0 {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(i.ContentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// unmarshal the item value using the codec of the client that retrieved it
+func (i *I) unmarshal(v any) error {
+	if i.codec == nil {
+		return defaultCodec.Unmarshal(i.Value, v)
+	}
+	return i.codec.Unmarshal(i.Value, v)
+}
+
 type IL []I
 
 // Typed returns a typed slice of the requested type
@@ -54,7 +97,7 @@ func convert(i I, factory func() any) (any, error) {
 	if reflect.ValueOf(t).Kind() != reflect.Ptr {
 		return nil, fmt.Errorf("factory argument return type must be a pointer")
 	}
-	err := json.Unmarshal(i.Value, t)
+	err := i.unmarshal(t)
 	return t, err
 }
 
@@ -62,6 +105,8 @@ func convert(i I, factory func() any) (any, error) {
 type L struct {
 	From string `json:"from"`
 	To   string `json:"to"`
+	// Attributes describe the relationship between the linked items, e.g. a relation label or a weight
+	Attributes map[string]string `json:"attributes,omitempty"`
 }
 
 // T the definition of an item tag
@@ -77,3 +122,81 @@ type TT struct {
 	Schema []byte `json:"schema"`
 	Proto  []byte `json:"proto"`
 }
+
+// SaveMeta the metadata recorded alongside a change to an item
+type SaveMeta struct {
+	// Author who is making the change
+	Author string
+	// Reason why the change is made
+	Reason string
+}
+
+func (m SaveMeta) headers() http.Header {
+	headers := http.Header{}
+	if len(m.Author) > 0 {
+		headers.Set("Source-Author", m.Author)
+	}
+	if len(m.Reason) > 0 {
+		headers.Set("Source-Reason", m.Reason)
+	}
+	return headers
+}
+
+// AuditEvent a change made to an item
+type AuditEvent struct {
+	// ItemKey the key of the changed item
+	ItemKey string `json:"item_key"`
+	// Actor who made the change
+	Actor string `json:"actor"`
+	// Time when the change was made
+	Time time.Time `json:"time"`
+	// Operation one of create, update, delete, tag or link
+	Operation string `json:"operation"`
+	// Reason why the change was made, if recorded
+	Reason string `json:"reason,omitempty"`
+	// Summary a short description of what changed, if available
+	Summary string `json:"summary,omitempty"`
+}
+
+// StoreStats the overall statistics of the source server store
+type StoreStats struct {
+	// Items the total number of items
+	Items int `json:"items"`
+	// ItemsPerType the number of items keyed by item type
+	ItemsPerType map[string]int `json:"items_per_type"`
+	// Links the total number of links
+	Links int `json:"links"`
+	// Tags the total number of tags
+	Tags int `json:"tags"`
+	// Partial true if the stats were computed client-side, in which case Links and Tags are not populated
+	Partial bool `json:"-"`
+}
+
+// SearchOptions the options used to scope and paginate a search
+type SearchOptions struct {
+	// Type restricts the search to items of the specified type
+	Type string
+	// Tags restricts the search to items carrying the specified tags
+	Tags []string
+	// Offset the number of results to skip
+	Offset int
+	// Limit the maximum number of results to return (0 = server default)
+	Limit int
+}
+
+func (o SearchOptions) query(q string) url.Values {
+	values := url.Values{"q": []string{q}}
+	if len(o.Type) > 0 {
+		values.Set("type", o.Type)
+	}
+	if len(o.Tags) > 0 {
+		values.Set("tag", strings.Join(o.Tags, "|"))
+	}
+	if o.Offset > 0 {
+		values.Set("offset", strconv.Itoa(o.Offset))
+	}
+	if o.Limit > 0 {
+		values.Set("limit", strconv.Itoa(o.Limit))
+	}
+	return values
+}
@@ -0,0 +1,130 @@
+/*
+  Source Configuration Service
+  © 2022 Southwinds Tech Ltd - www.southwinds.io
+  Licensed under the Apache License, Version 2.0 at http://www.apache.org/licenses/LICENSE-2.0
+  Contributors to this project, hereby assign copyright in this code to the project,
+  to be licensed under the same terms as the rest of the code.
+*/
+
+package src
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// typeVersionSeparator separates the type key from its version in a versioned type key, e.g. AAA:v2
+const typeVersionSeparator = ":"
+
+// TypeKey the key of a version of a type, e.g. AAA:v2, or the type key itself if version is empty
+// each version is registered as a type of its own, so versions of a schema can be used side by side; an item saved
+// against a version records the versioned type key in I.Type, binding the item to the schema it was validated against
+func TypeKey(key, version string) string {
+	if len(version) == 0 {
+		return key
+	}
+	return key + typeVersionSeparator + version
+}
+
+// ParseTypeKey splits a type key into the key and the version, empty if the type key is not versioned
+func ParseTypeKey(typeKey string) (key, version string) {
+	key, version, _ = strings.Cut(typeKey, typeVersionSeparator)
+	return key, version
+}
+
+// SetTypeVersion registers a version of the type with the json schema reflected from obj, see SetType and TypeKey
+func (c *Client) SetTypeVersion(key, version string, obj any) error {
+	if err := checkTypeVersion(key, version); err != nil {
+		return err
+	}
+	return c.SetType(TypeKey(key, version), obj)
+}
+
+// GetTypeVersion the definition of a version of the type, the latest version if version is empty
+func (c *Client) GetTypeVersion(key, version string) (*TT, error) {
+	if len(version) == 0 {
+		latest, err := c.LatestTypeVersion(key)
+		if err != nil {
+			return nil, err
+		}
+		version = latest
+	}
+	return c.GetType(TypeKey(key, version))
+}
+
+// TypeVersions the versions registered for the type, oldest first
+// versions are ordered comparing their numbers numerically, e.g. v2 before v10, ignoring a leading v
+func (c *Client) TypeVersions(key string) ([]string, error) {
+	types, err := c.ListTypes()
+	if err != nil {
+		return nil, err
+	}
+	var versions []string
+	for _, t := range types {
+		if typeKey, version := ParseTypeKey(t.Key); typeKey == key && len(version) > 0 {
+			versions = append(versions, version)
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return compareVersions(versions[i], versions[j]) < 0
+	})
+	return versions, nil
+}
+
+// LatestTypeVersion the latest version registered for the type, empty if the type has no versions
+func (c *Client) LatestTypeVersion(key string) (string, error) {
+	versions, err := c.TypeVersions(key)
+	if err != nil || len(versions) == 0 {
+		return "", err
+	}
+	return versions[len(versions)-1], nil
+}
+
+// SaveTypeVersion saves the configuration item validated against a version of the type, see Save
+// if version is empty the latest version is used, or the type itself if it has no versions; the item records the
+// versioned type key it was saved with, so later versions of the type do not change how it is validated
+func (c *Client) SaveTypeVersion(key, itemType, version string, item Valid) error {
+	if len(version) == 0 {
+		latest, err := c.LatestTypeVersion(itemType)
+		if err != nil {
+			return err
+		}
+		version = latest
+	} else if err := checkTypeVersion(itemType, version); err != nil {
+		return err
+	}
+	return c.Save(key, TypeKey(itemType, version), item)
+}
+
+// checkTypeVersion checks the type key and version can be combined into a versioned type key
+func checkTypeVersion(key, version string) error {
+	if len(key) == 0 || len(version) == 0 {
+		return fmt.Errorf("a type key and a version are required")
+	}
+	if strings.Contains(key, typeVersionSeparator) || strings.Contains(version, typeVersionSeparator) {
+		return fmt.Errorf("invalid type version '%s': '%s' is reserved as the version separator", TypeKey(key, version), typeVersionSeparator)
+	}
+	return nil
+}
+
+// compareVersions compares two versions by their dot separated parts, numerically if both parts are numbers
+func compareVersions(a, b string) int {
+	partsA := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	partsB := strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < len(partsA) && i < len(partsB); i++ {
+		numA, errA := strconv.Atoi(partsA[i])
+		numB, errB := strconv.Atoi(partsB[i])
+		switch {
+		case errA == nil && errB == nil && numA != numB:
+			if numA < numB {
+				return -1
+			}
+			return 1
+		case (errA != nil || errB != nil) && partsA[i] != partsB[i]:
+			return strings.Compare(partsA[i], partsB[i])
+		}
+	}
+	return len(partsA) - len(partsB)
+}
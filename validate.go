@@ -0,0 +1,418 @@
+/*
+  Source Configuration Service
+  © 2022 Southwinds Tech Ltd - www.southwinds.io
+  Licensed under the Apache License, Version 2.0 at http://www.apache.org/licenses/LICENSE-2.0
+  Contributors to this project, hereby assign copyright in this code to the project,
+  to be licensed under the same terms as the rest of the code.
+*/
+
+package src
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// FieldError a violation of a type schema by a field of an item value
+type FieldError struct {
+	// Path the JSON Pointer to the offending field, empty for the value itself
+	Path string
+	// Message describes the rule violated
+	Message string
+}
+
+func (e FieldError) Error() string {
+	if len(e.Path) == 0 {
+		return e.Message
+	}
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+// SchemaValidationError returned when a value does not validate against the schema of an item type
+type SchemaValidationError struct {
+	Type   string
+	Errors []FieldError
+}
+
+func (e *SchemaValidationError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, fieldErr := range e.Errors {
+		msgs[i] = fieldErr.Error()
+	}
+	return fmt.Sprintf("value does not validate against type '%s': %s", e.Type, strings.Join(msgs, "; "))
+}
+
+// ValidateAgainstType validates the sample against the json schema of the item type, without saving anything
+// the schema is served from the schema cache; returns a *SchemaValidationError listing the offending fields
+// if the sample does not validate, and ErrNotFound if the type does not exist
+// the validation runs client-side and covers the keywords used by the schemas SetType registers:
+// type, properties, required, additionalProperties, items, enum, const, bounds, lengths, pattern, $ref and allOf/anyOf/oneOf
+func (c *Client) ValidateAgainstType(itemType string, sample any) error {
+	schema, err := c.schema(itemType)
+	if err != nil {
+		return err
+	}
+	sampleBytes, err := c.opts.Codec.Marshal(sample)
+	if err != nil {
+		return fmt.Errorf("cannot marshal sample: %s", err)
+	}
+	var value any
+	if err = defaultCodec.Unmarshal(sampleBytes, &value); err != nil {
+		return fmt.Errorf("cannot unmarshal sample: %s", err)
+	}
+	v := &schemaValidator{root: schema}
+	if err = v.validate(schema, value, ""); err != nil {
+		return fmt.Errorf("cannot validate sample against type '%s': %s", itemType, err)
+	}
+	if len(v.errs) > 0 {
+		return &SchemaValidationError{Type: itemType, Errors: v.errs}
+	}
+	return nil
+}
+
+// schemaValidator validates json values against a json schema collecting the field errors found
+type schemaValidator struct {
+	root json.RawMessage
+	errs []FieldError
+	// depth guards against circular references
+	depth int
+}
+
+func (v *schemaValidator) fail(path, format string, args ...any) {
+	v.errs = append(v.errs, FieldError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// validate validates the value at path against the schema, returning an error only if the schema is invalid
+func (v *schemaValidator) validate(schemaBytes json.RawMessage, value any, path string) error {
+	var schema map[string]json.RawMessage
+	if err := defaultCodec.Unmarshal(schemaBytes, &schema); err != nil {
+		var allow bool
+		// true and false are valid schemas accepting and rejecting any value
+		if json.Unmarshal(schemaBytes, &allow) == nil {
+			if !allow {
+				v.fail(path, "is not allowed")
+			}
+			return nil
+		}
+		return err
+	}
+	if ref, ok := schema["$ref"]; ok {
+		if err := v.validateRef(ref, value, path); err != nil {
+			return err
+		}
+	}
+	if raw, ok := schema["type"]; ok {
+		var types []string
+		if firstChar(raw) == '[' {
+			if err := json.Unmarshal(raw, &types); err != nil {
+				return err
+			}
+		} else {
+			var t string
+			if err := json.Unmarshal(raw, &t); err != nil {
+				return err
+			}
+			types = []string{t}
+		}
+		if !matchesType(value, types) {
+			v.fail(path, "expected %s, got %s", strings.Join(types, " or "), jsonType(value))
+			// the remaining keywords are type specific
+			return nil
+		}
+	}
+	if raw, ok := schema["enum"]; ok {
+		var enum []any
+		if err := defaultCodec.Unmarshal(raw, &enum); err != nil {
+			return err
+		}
+		if !containsValue(enum, value) {
+			v.fail(path, "must be one of %s", string(raw))
+		}
+	}
+	if raw, ok := schema["const"]; ok {
+		var constant any
+		if err := defaultCodec.Unmarshal(raw, &constant); err != nil {
+			return err
+		}
+		if !containsValue([]any{constant}, value) {
+			v.fail(path, "must be %s", string(raw))
+		}
+	}
+	if err := v.validateCombinators(schema, value, path); err != nil {
+		return err
+	}
+	switch val := value.(type) {
+	case map[string]any:
+		return v.validateObject(schema, val, path)
+	case []any:
+		return v.validateArray(schema, val, path)
+	case string:
+		return v.validateString(schema, val, path)
+	case json.Number:
+		return v.validateNumber(schema, val, path)
+	}
+	return nil
+}
+
+// validateRef validates the value against a schema referenced within the root schema, e.g. #/$defs/Name
+func (v *schemaValidator) validateRef(raw json.RawMessage, value any, path string) error {
+	var ref string
+	if err := json.Unmarshal(raw, &ref); err != nil {
+		return err
+	}
+	if !strings.HasPrefix(ref, "#") {
+		return fmt.Errorf("unsupported schema reference '%s': only references within the schema are supported", ref)
+	}
+	if v.depth > 100 {
+		return fmt.Errorf("schema reference '%s' is circular", ref)
+	}
+	target, err := resolvePointer(v.root, ref[1:])
+	if err != nil {
+		return err
+	}
+	v.depth++
+	defer func() { v.depth-- }()
+	return v.validate(target, value, path)
+}
+
+func (v *schemaValidator) validateCombinators(schema map[string]json.RawMessage, value any, path string) error {
+	for _, keyword := range []string{"allOf", "anyOf", "oneOf"} {
+		raw, ok := schema[keyword]
+		if !ok {
+			continue
+		}
+		var subSchemas []json.RawMessage
+		if err := json.Unmarshal(raw, &subSchemas); err != nil {
+			return err
+		}
+		matches := 0
+		for _, subSchema := range subSchemas {
+			sub := &schemaValidator{root: v.root, depth: v.depth}
+			if err := sub.validate(subSchema, value, path); err != nil {
+				return err
+			}
+			if len(sub.errs) == 0 {
+				matches++
+			} else if keyword == "allOf" {
+				v.errs = append(v.errs, sub.errs...)
+			}
+		}
+		switch {
+		case keyword == "anyOf" && matches == 0:
+			v.fail(path, "does not match any of the allowed schemas")
+		case keyword == "oneOf" && matches != 1:
+			v.fail(path, "must match exactly one of the allowed schemas, matches %d", matches)
+		}
+	}
+	return nil
+}
+
+func (v *schemaValidator) validateObject(schema map[string]json.RawMessage, value map[string]any, path string) error {
+	if raw, ok := schema["required"]; ok {
+		var required []string
+		if err := json.Unmarshal(raw, &required); err != nil {
+			return err
+		}
+		for _, name := range required {
+			if _, exists := value[name]; !exists {
+				v.fail(path+"/"+escapeToken(name), "is required")
+			}
+		}
+	}
+	var properties map[string]json.RawMessage
+	if raw, ok := schema["properties"]; ok {
+		if err := json.Unmarshal(raw, &properties); err != nil {
+			return err
+		}
+	}
+	names := make([]string, 0, len(value))
+	for name := range value {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	additional, hasAdditional := schema["additionalProperties"]
+	for _, name := range names {
+		fieldPath := path + "/" + escapeToken(name)
+		if propSchema, ok := properties[name]; ok {
+			if err := v.validate(propSchema, value[name], fieldPath); err != nil {
+				return err
+			}
+			continue
+		}
+		if hasAdditional {
+			if err := v.validate(additional, value[name], fieldPath); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (v *schemaValidator) validateArray(schema map[string]json.RawMessage, value []any, path string) error {
+	if err := v.checkLength(schema, "minItems", "maxItems", len(value), "items", path); err != nil {
+		return err
+	}
+	if raw, ok := schema["items"]; ok {
+		for i, item := range value {
+			if err := v.validate(raw, item, fmt.Sprintf("%s/%d", path, i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (v *schemaValidator) validateString(schema map[string]json.RawMessage, value string, path string) error {
+	if err := v.checkLength(schema, "minLength", "maxLength", utf8.RuneCountInString(value), "characters", path); err != nil {
+		return err
+	}
+	if raw, ok := schema["pattern"]; ok {
+		var pattern string
+		if err := json.Unmarshal(raw, &pattern); err != nil {
+			return err
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern '%s': %s", pattern, err)
+		}
+		if !re.MatchString(value) {
+			v.fail(path, "must match pattern '%s'", pattern)
+		}
+	}
+	return nil
+}
+
+func (v *schemaValidator) validateNumber(schema map[string]json.RawMessage, value json.Number, path string) error {
+	n, err := value.Float64()
+	if err != nil {
+		return nil
+	}
+	bounds := []struct {
+		keyword string
+		fails   func(n, bound float64) bool
+		message string
+	}{
+		{"minimum", func(n, bound float64) bool { return n < bound }, "must be >= %v"},
+		{"maximum", func(n, bound float64) bool { return n > bound }, "must be <= %v"},
+		{"exclusiveMinimum", func(n, bound float64) bool { return n <= bound }, "must be > %v"},
+		{"exclusiveMaximum", func(n, bound float64) bool { return n >= bound }, "must be < %v"},
+	}
+	for _, b := range bounds {
+		raw, ok := schema[b.keyword]
+		if !ok {
+			continue
+		}
+		var bound float64
+		if err = json.Unmarshal(raw, &bound); err != nil {
+			// draft-04 boolean exclusive bounds are not supported
+			continue
+		}
+		if b.fails(n, bound) {
+			v.fail(path, b.message, bound)
+		}
+	}
+	return nil
+}
+
+// checkLength checks the length of a string or array against the min and max keywords
+func (v *schemaValidator) checkLength(schema map[string]json.RawMessage, minKeyword, maxKeyword string, length int, unit, path string) error {
+	if raw, ok := schema[minKeyword]; ok {
+		var min int
+		if err := json.Unmarshal(raw, &min); err != nil {
+			return err
+		}
+		if length < min {
+			v.fail(path, "must have at least %d %s", min, unit)
+		}
+	}
+	if raw, ok := schema[maxKeyword]; ok {
+		var max int
+		if err := json.Unmarshal(raw, &max); err != nil {
+			return err
+		}
+		if length > max {
+			v.fail(path, "must have at most %d %s", max, unit)
+		}
+	}
+	return nil
+}
+
+// matchesType true if the json value is of any of the json schema types
+func matchesType(value any, types []string) bool {
+	actual := jsonType(value)
+	for _, t := range types {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonType the json schema type of a value decoded using json.Number
+func jsonType(value any) string {
+	switch val := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	case json.Number:
+		if _, err := val.Int64(); err == nil {
+			return "integer"
+		}
+		if f, err := val.Float64(); err == nil && f == math.Trunc(f) && !math.IsInf(f, 0) {
+			return "integer"
+		}
+		return "number"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// containsValue true if the value is equal to any of the candidates, comparing numbers exactly by value
+func containsValue(candidates []any, value any) bool {
+	for _, candidate := range candidates {
+		if a, ok := candidate.(json.Number); ok {
+			if b, ok := value.(json.Number); ok && equalNumbers(a, b) {
+				return true
+			}
+			continue
+		}
+		if reflect.DeepEqual(candidate, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// equalNumbers true if the numbers have the same value, e.g. 80 and 80.0, without rounding them to float64 so that
+// integers above 2^53 are told apart
+func equalNumbers(a, b json.Number) bool {
+	if ai, err := a.Int64(); err == nil {
+		if bi, err := b.Int64(); err == nil {
+			return ai == bi
+		}
+	}
+	ar, okA := new(big.Rat).SetString(a.String())
+	br, okB := new(big.Rat).SetString(b.String())
+	if !okA || !okB {
+		return a == b
+	}
+	return ar.Cmp(br) == 0
+}
+
+// escapeToken escapes a JSON Pointer reference token as per RFC 6901
+func escapeToken(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+}
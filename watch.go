@@ -0,0 +1,22 @@
+/*
+  Source Configuration Service
+  © 2022 Southwinds Tech Ltd - www.southwinds.io
+  Licensed under the Apache License, Version 2.0 at http://www.apache.org/licenses/LICENSE-2.0
+  Contributors to this project, hereby assign copyright in this code to the project,
+  to be licensed under the same terms as the rest of the code.
+*/
+
+package src
+
+import (
+	"context"
+	"fmt"
+)
+
+// LoadAndWatch loads the item and then sends each of its subsequent changes on updates until the context is done,
+// subscribing to the changes before the load and skipping the versions already loaded so that no update is missed
+// the source server has no change feed to subscribe to yet, so it returns an error wrapping ErrUnsupported; reading
+// the item periodically instead would silently miss the changes made between two reads
+func (c *Client) LoadAndWatch(ctx context.Context, key string, prototype any) (initial any, updates <-chan any, errs <-chan error, err error) {
+	return nil, nil, nil, fmt.Errorf("cannot watch item '%s': %w: the source server does not offer a change feed", key, ErrUnsupported)
+}